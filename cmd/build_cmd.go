@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"docker/container/container_init"
+	"docker/container/image"
+	"docker/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// BuildCommand `mdocker build`命令定义
+var BuildCommand = cli.Command{
+	Name:  "build",
+	Usage: "build an image from a build file, mdocker build -t [image] [context]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  buildFlagFile,
+			Usage: "path of the build file, default [context]/Dockerfile",
+		},
+		cli.StringFlag{
+			Name:  buildFlagTag,
+			Usage: "name of the built image",
+		},
+		cli.BoolFlag{
+			Name:  buildFlagNoCache,
+			Usage: "do not use cache when building the image",
+		},
+	},
+	Action: buildCmdAction,
+}
+
+// 镜像构建过程中的状态
+type imageBuilder struct {
+	contextDir   string
+	noCache      bool
+	hasFrom      bool
+	parentConfig []byte                // 基础镜像的原始config
+	layers       []string              // 当前已生成的layer, 由最底层到最顶层排列
+	conf         image.ContainerConfig // 当前的容器config
+}
+
+// `mdocker build`命令主逻辑入口
+func buildCmdAction(ctx *cli.Context) error {
+	imageName := ctx.String(buildFlagTag)
+	if imageName == "" {
+		return fmt.Errorf("missing image name")
+	}
+	contextDir := ctx.Args().Get(0)
+	if contextDir == "" {
+		contextDir = "."
+	}
+	buildFile := ctx.String(buildFlagFile)
+	if buildFile == "" {
+		buildFile = path.Join(contextDir, defaultBuildFileName)
+	}
+
+	file, err := os.Open(buildFile)
+	if err != nil {
+		return fmt.Errorf("build file open error, %v", err)
+	}
+	defer file.Close()
+	instructions, err := image.ParseBuildFile(file)
+	if err != nil {
+		return err
+	}
+
+	builder := &imageBuilder{
+		contextDir: contextDir,
+		noCache:    ctx.Bool(buildFlagNoCache),
+	}
+	for i, instruction := range instructions {
+		fmt.Printf("Step %d/%d : %s\n", i+1, len(instructions), instruction)
+		if err = builder.execute(instruction); err != nil {
+			return fmt.Errorf("step %d failed, %v", i+1, err)
+		}
+	}
+
+	return builder.commit(imageName)
+}
+
+// 执行单条构建指令
+func (b *imageBuilder) execute(line string) error {
+	instruction, value := image.SplitInstruction(line)
+	if value == "" {
+		return fmt.Errorf("instruction %s missing params", instruction)
+	}
+	if instruction != "FROM" && !b.hasFrom {
+		return fmt.Errorf("build file must start with FROM")
+	}
+
+	switch instruction {
+	case "FROM":
+		return b.from(value)
+	case "RUN":
+		return b.run(line, value)
+	case "COPY":
+		return b.copy(line, value)
+	default:
+		return image.ApplyConfigChange(&b.conf, line)
+	}
+}
+
+// FROM: 以本地镜像作为基础镜像, scratch表示空镜像
+func (b *imageBuilder) from(imageName string) error {
+	if b.hasFrom {
+		return fmt.Errorf("multiple FROM is not supported")
+	}
+	b.hasFrom = true
+	if imageName == "scratch" {
+		return nil
+	}
+
+	img, err := image.ResolveImage(imageName)
+	if err != nil {
+		return err
+	}
+	b.layers = append([]string{}, img.Layers...)
+	if b.parentConfig, err = img.GetRawConfig(); err != nil {
+		return err
+	}
+	imageConfig, err := img.GetConfig()
+	if err != nil {
+		return err
+	}
+	b.conf = imageConfig.Config
+
+	return nil
+}
+
+// RUN: 在临时容器中执行命令, 将容器的修改保存为新layer, 相同父layer和指令的步骤直接使用缓存
+func (b *imageBuilder) run(line, value string) error {
+	cacheKey, err := image.GetBuildCacheKey(b.layers, &b.conf, line)
+	if err != nil {
+		return err
+	}
+	if layer, hit := image.GetBuildCache(cacheKey); hit && !b.noCache {
+		fmt.Printf(" ---> Using cache %s\n", layer)
+		b.layers = append(b.layers, layer)
+		return nil
+	}
+
+	layer, err := b.runInContainer(image.ParseCommandValue(value))
+	if err != nil {
+		return err
+	}
+	if err = image.SaveBuildCache(cacheKey, line, layer); err != nil {
+		return err
+	}
+	fmt.Printf(" ---> %s\n", layer)
+	b.layers = append(b.layers, layer)
+
+	return nil
+}
+
+// 使用当前layer创建临时容器执行命令, 返回容器修改生成的layer
+func (b *imageBuilder) runInContainer(command []string) (string, error) {
+	if len(b.layers) == 0 {
+		return "", fmt.Errorf("RUN is not supported on scratch image")
+	}
+
+	containerName := "build-" + randStringBytes(containerNameLength)
+	initCmd, initPipe, err := container_init.NewContainerProcess(true, "", containerName, b.layers, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := container_init.DeleteWorkSpace(containerName, ""); err != nil {
+			utils.LoggerUtil.Errorf("delete build container workspace error, %v", err)
+		}
+	}()
+
+	initConf := container_init.NewInitConfig(command, &b.conf, containerName)
+	if err = initConf.SetRootlessRootfs(containerName, b.layers, ""); err != nil {
+		_ = initPipe.Close()
+		return "", err
+	}
+
+	// 构建过程不需要交互输入
+	initCmd.Stdin = nil
+	if err = initCmd.Start(); err != nil {
+		_ = initPipe.Close()
+		return "", err
+	}
+	if err = container_init.SendInitConfig(initConf, initPipe); err != nil {
+		return "", err
+	}
+	if err = initCmd.Wait(); err != nil {
+		return "", fmt.Errorf("command %v failed, %v", command, err)
+	}
+
+	return image.CommitLayer(container_init.GetContainerRwLayerPath(containerName))
+}
+
+// COPY: 将构建上下文中的文件复制到镜像中, 生成新layer, 相同父layer、指令和源文件内容的步骤直接使用缓存
+func (b *imageBuilder) copy(line, value string) error {
+	args := strings.Fields(value)
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &args); err != nil {
+			return fmt.Errorf("invalid COPY params %s", value)
+		}
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("COPY requires at least one source and a destination")
+	}
+	srcs, dest := args[:len(args)-1], args[len(args)-1]
+	isDirDest := strings.HasSuffix(dest, "/") || len(srcs) > 1
+	if !path.IsAbs(dest) {
+		dest = path.Join("/", b.conf.WorkingDir, dest)
+	}
+
+	// 源文件只能位于构建上下文中
+	srcPaths := make([]string, 0, len(srcs))
+	for _, src := range srcs {
+		srcPaths = append(srcPaths, path.Join(b.contextDir, path.Clean("/"+src)))
+	}
+	srcDigest, err := image.GetFilesDigest(srcPaths)
+	if err != nil {
+		return err
+	}
+	cacheKey, err := image.GetBuildCacheKey(b.layers, &b.conf, line+"\n"+srcDigest)
+	if err != nil {
+		return err
+	}
+	if layer, hit := image.GetBuildCache(cacheKey); hit && !b.noCache {
+		fmt.Printf(" ---> Using cache %s\n", layer)
+		b.layers = append(b.layers, layer)
+		return nil
+	}
+
+	// 在临时目录中按镜像内的路径组织文件, 再将临时目录提交为layer
+	stageDir, err := os.MkdirTemp("", "mdocker-build-")
+	if err != nil {
+		return fmt.Errorf("tmp dir create error, %v", err)
+	}
+	defer os.RemoveAll(stageDir)
+	if err = os.Chmod(stageDir, 0755); err != nil {
+		return err
+	}
+
+	stageDest := path.Join(stageDir, dest)
+	for i, srcPath := range srcPaths {
+		if err = copyIntoStage(srcPath, stageDest, isDirDest); err != nil {
+			return fmt.Errorf("copy %s error, %v", srcs[i], err)
+		}
+	}
+	if err = resetStageDirTimes(stageDir, stageDest); err != nil {
+		return err
+	}
+
+	layer, err := image.CommitLayer(stageDir)
+	if err != nil {
+		return err
+	}
+	if err = image.SaveBuildCache(cacheKey, line, layer); err != nil {
+		return err
+	}
+	fmt.Printf(" ---> %s\n", layer)
+	b.layers = append(b.layers, layer)
+
+	return nil
+}
+
+// 复制单个源文件/目录: 目录复制其中的内容, 文件复制到目标目录下或目标路径
+func copyIntoStage(srcPath, stageDest string, isDirDest bool) error {
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	target := stageDest
+	destDir := stageDest
+	if stat.IsDir() {
+		srcPath += "/."
+	} else if !isDirDest {
+		destDir = path.Dir(stageDest)
+	} else {
+		target = stageDest + "/"
+	}
+	if err = os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	output, err := exec.Command("cp", "-a", srcPath, target).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v, %s", err, output)
+	}
+
+	return nil
+}
+
+// COPY步骤临时目录中由构建过程创建的目录使用的修改时间
+var stageModTime = time.Unix(0, 0)
+
+// 将临时目录中由构建过程创建的目录设置为固定的修改时间, 使相同内容生成的layer digest保持一致
+func resetStageDirTimes(stageDir, stageDest string) error {
+	for dirPath := stageDest; strings.HasPrefix(dirPath, stageDir); dirPath = path.Dir(dirPath) {
+		info, err := os.Lstat(dirPath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if err = os.Chtimes(dirPath, stageModTime, stageModTime); err != nil {
+				return fmt.Errorf("chtimes %s error, %v", dirPath, err)
+			}
+		}
+		if dirPath == stageDir {
+			break
+		}
+	}
+
+	return nil
+}
+
+// 使用构建结果创建镜像, 并将镜像引用指向新镜像
+func (b *imageBuilder) commit(imageRef string) error {
+	img, err := image.CreateChildImage(b.parentConfig, b.layers, &b.conf, "mdocker build")
+	if err != nil {
+		return err
+	}
+	if err = image.AddReference(imageRef, img.Id); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully built %s\n", img.GetShortId())
+	fmt.Printf("Successfully tagged %s\n", imageRef)
+
+	return nil
+}
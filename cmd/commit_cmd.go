@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"docker/container/container_info"
+	"docker/container/container_init"
+	"docker/container/image"
+	"fmt"
+	"github.com/urfave/cli"
+	"strings"
+)
+
+// CommitCommand `mdocker commit`命令定义
+var CommitCommand = cli.Command{
+	Name:  "commit",
+	Usage: "create a new image from a container's changes, mdocker commit [container] [image]",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  commitFlagChange,
+			Usage: "apply instruction to the image config, e.g. --change 'CMD [\"sh\"]'",
+		},
+	},
+	Action: commitCmdAction,
+}
+
+// `mdocker commit`命令主逻辑入口
+func commitCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		return fmt.Errorf("missing container name or image name")
+	}
+
+	containerName := ctx.Args().Get(0)
+	imageName := ctx.Args().Get(1)
+
+	return commitContainer(containerName, imageName, ctx.StringSlice(commitFlagChange))
+}
+
+// 将容器的rw layer提交为新layer, 叠加在父镜像layer之上生成新镜像
+func commitContainer(containerName, imageName string, changes []string) error {
+	cInfo, err := container_info.GetContainerInfoByContainerName(containerName)
+	if err != nil {
+		return err
+	}
+	if _, err = image.ParseReference(imageName); err != nil {
+		return err
+	}
+
+	// 父镜像config, 父镜像已被删除时从空config开始
+	var parentConfig []byte
+	imageConfig := &image.ImageConfig{}
+	if exists, _ := image.IsImageExists(cInfo.ImageId); exists {
+		parentImage, err := image.GetImage(cInfo.ImageId)
+		if err != nil {
+			return err
+		}
+		if parentConfig, err = parentImage.GetRawConfig(); err != nil {
+			return err
+		}
+		if imageConfig, err = parentImage.GetConfig(); err != nil {
+			return err
+		}
+	}
+	for _, change := range changes {
+		if err = image.ApplyConfigChange(&imageConfig.Config, change); err != nil {
+			return err
+		}
+	}
+
+	// 提交容器的修改
+	layer, err := image.CommitLayer(container_init.GetContainerRwLayerPath(containerName))
+	if err != nil {
+		return fmt.Errorf("commit container layer error, %v", err)
+	}
+	layers := append(append([]string{}, cInfo.ImageLayers...), layer)
+
+	createdBy := "mdocker commit " + containerName
+	if len(changes) > 0 {
+		createdBy += " --change " + strings.Join(changes, " --change ")
+	}
+	img, err := image.CreateChildImage(parentConfig, layers, &imageConfig.Config, createdBy)
+	if err != nil {
+		return err
+	}
+	if err = image.AddReference(imageName, img.Id); err != nil {
+		return err
+	}
+	fmt.Println(img.Id)
+
+	return nil
+}
@@ -3,18 +3,45 @@ package cmd
 import (
 	"docker/config"
 	"docker/container/container_info"
+	"docker/container/container_init"
 	_ "docker/container/nsenter"
+	"docker/container/seccomp"
 	"docker/utils"
 	"fmt"
 	"github.com/urfave/cli"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 )
 
 var ExecCommand = cli.Command{
-	Name:   "exec",
-	Usage:  "exec a command into a container",
+	Name:  "exec",
+	Usage: "exec a command into a container",
+	// 参数按顺序解析, 容器名之后的参数全部属于用户命令
+	SkipArgReorder: true,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  execCmdFlagTty,
+			Usage: "allocate a pseudo-terminal for the command",
+		},
+		cli.StringSliceFlag{
+			Name:  execCmdFlagCapAdd,
+			Usage: "add linux capabilities to the command, default the capabilities of the container",
+		},
+		cli.StringSliceFlag{
+			Name:  execCmdFlagCapDrop,
+			Usage: "drop linux capabilities from the command",
+		},
+		cli.StringFlag{
+			Name:  execCmdFlagUser,
+			Usage: "username or uid, format: <name|uid>[:<group|gid>], default the user of the container",
+		},
+		cli.StringFlag{
+			Name:  execCmdFlagWorkdir,
+			Usage: "working directory inside the container, default the working directory of the container",
+		},
+	},
 	Action: execCmdAction,
 }
 
@@ -24,7 +51,7 @@ func execCmdAction(ctx *cli.Context) error {
 	if os.Getenv(config.EnvExecPid) != "" {
 		utils.LoggerUtil.Infof("pid callback pid %v", os.Getgid())
 
-		return nil
+		return container_init.ExecProcessInit()
 	}
 
 	if len(ctx.Args()) < 2 {
@@ -33,33 +60,106 @@ func execCmdAction(ctx *cli.Context) error {
 	containerName := ctx.Args()[0]
 	commandArray := ctx.Args()[1:]
 
-	return execContainer(containerName, commandArray)
+	return execContainer(ctx, containerName, commandArray)
 }
 
 // 在指定name的容器中执行comArr命令
-func execContainer(containerName string, comArray []string) error {
-	// 获取容器init进程的pid
-	pid, err := container_info.GetContainerPidByName(containerName)
+// 未指定用户和工作目录时使用容器的运行用户和工作目录, capability在容器capability的基础上增删
+func execContainer(ctx *cli.Context, containerName string, comArray []string) error {
+	cInfo, err := container_info.GetContainerInfoByContainerName(containerName)
 	if err != nil {
-		return fmt.Errorf("exec container getContainerPidByName %s error %v", containerName, err)
+		return fmt.Errorf("exec container getContainerInfoByContainerName %s error %v", containerName, err)
 	}
-	// 拼接command
-	cmdStr := strings.Join(comArray, " ")
-	utils.LoggerUtil.Infof("container pid: %s, command: %s", pid, cmdStr)
+	utils.LoggerUtil.Infof("container pid: %s, command: %s", cInfo.Pid, strings.Join(comArray, " "))
+	tty := ctx.Bool(execCmdFlagTty)
 
+	// 命令使用容器的环境变量执行
+	execConf := &container_init.InitConfig{
+		Version:  container_init.InitConfigVersion,
+		Args:     comArray,
+		Env:      cInfo.Env,
+		User:     ctx.String(execCmdFlagUser),
+		Cwd:      ctx.String(execCmdFlagWorkdir),
+		Terminal: tty,
+	}
+	if execConf.User == "" {
+		execConf.User = cInfo.User
+	}
+	if execConf.Cwd == "" {
+		execConf.Cwd = cInfo.Cwd
+	}
+	if execConf.Cwd != "" && !path.IsAbs(execConf.Cwd) {
+		return fmt.Errorf("working directory %s is invalid, it needs to be an absolute path", execConf.Cwd)
+	}
+	if len(execConf.Env) == 0 {
+		execConf.Env = []string{config.DefaultPathEnv}
+	}
+	baseCapabilities := cInfo.Capabilities
+	if baseCapabilities == nil {
+		baseCapabilities = container_init.DefaultCapabilities()
+	}
+	execConf.Capabilities, err = container_init.ResolveCapabilities(baseCapabilities,
+		ctx.StringSlice(execCmdFlagCapAdd), ctx.StringSlice(execCmdFlagCapDrop))
+	if err != nil {
+		return err
+	}
+
+	// 与容器使用相同的seccomp配置, 特权容器和关闭seccomp的容器不过滤系统调用, 配置无法读取时不执行命令
+	if !cInfo.Privileged && !seccomp.IsUnconfined(cInfo.SecurityOpt) {
+		profilePath := path.Join(container_info.GetContainerInfoDirPath(containerName), seccomp.ProfileFileName)
+		if execConf.Seccomp, err = seccomp.LoadProfile(profilePath); err != nil {
+			return fmt.Errorf("exec container %s error %v", containerName, err)
+		}
+	}
+
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return err
+	}
 	cmd := exec.Command("/proc/self/exe", "exec")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{readPipe}
+	// nsenter根据该环境变量在进程启动前加入容器的namespace
+	cmd.Env = append(os.Environ(), config.EnvExecPid+"="+cInfo.Pid)
 
-	if err = os.Setenv(config.EnvExecPid, pid); err != nil {
-		return fmt.Errorf("exec pid env set error: %v", err)
+	var consoleSocket *os.File
+	if tty {
+		var childSocket *os.File
+		if consoleSocket, childSocket, err = container_init.NewConsoleSocket(); err != nil {
+			return err
+		}
+		defer consoleSocket.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, childSocket)
+	}
+
+	err = cmd.Start()
+	for _, file := range cmd.ExtraFiles {
+		_ = file.Close()
+	}
+	if err != nil {
+		_ = writePipe.Close()
+		return fmt.Errorf("exec container %s error %v", containerName, err)
 	}
-	if err = os.Setenv(config.EnvExecCmd, cmdStr); err != nil {
-		return fmt.Errorf("exec cmd env set error: %v", err)
+
+	if err = container_init.SendInitConfig(execConf, writePipe); err != nil {
+		return err
 	}
 
-	if err = cmd.Run(); err != nil {
+	if tty {
+		console, consoleErr := container_init.ReceiveConsole(consoleSocket)
+		if consoleErr != nil {
+			_ = cmd.Wait()
+			return consoleErr
+		}
+		detachConsole := container_init.AttachConsole(console)
+		err = cmd.Wait()
+		detachConsole()
+	} else {
+		err = cmd.Wait()
+	}
+	if err != nil {
 		return fmt.Errorf("exec container %s error %v", containerName, err)
 	}
 
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"docker/container/container_info"
+	"docker/container/image"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// ImagesCommand `mdocker images`命令定义
+var ImagesCommand = cli.Command{
+	Name:   "images",
+	Usage:  "list all images",
+	Action: imagesCmdAction,
+}
+
+// RmiCommand `mdocker rmi`命令定义
+var RmiCommand = cli.Command{
+	Name:  "rmi",
+	Usage: "remove one or more images, mdocker rmi [image...]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  imageFlagForce,
+			Usage: "remove the image even if it is used by containers",
+		},
+	},
+	Action: rmiCmdAction,
+}
+
+// TagCommand `mdocker tag`命令定义
+var TagCommand = cli.Command{
+	Name:   "tag",
+	Usage:  "create a tag that refers to an image, mdocker tag [source] [target]",
+	Action: tagCmdAction,
+}
+
+// ImageCommand `mdocker image`命令定义
+var ImageCommand = cli.Command{
+	Name:  "image",
+	Usage: "image commands",
+	Subcommands: []cli.Command{
+		{
+			Name:   "inspect",
+			Usage:  "print the metadata of an image in json, mdocker image inspect [image]",
+			Action: imageInspectAction,
+		},
+		{
+			Name:   "verify",
+			Usage:  "rehash the stored layers of images to detect corruption, mdocker image verify [image...]",
+			Action: imageVerifyAction,
+		},
+	},
+}
+
+// 镜像inspect输出内容
+type imageInspectInfo struct {
+	Id          string          `json:"id"`
+	RepoTags    []string        `json:"repoTags"`
+	RepoDigests []string        `json:"repoDigests"`
+	Layers      []string        `json:"layers"`
+	Size        int64           `json:"size"`
+	CreatedTime string          `json:"createTime"`
+	Config      json.RawMessage `json:"config,omitempty"`
+}
+
+// `mdocker images`命令主逻辑入口
+func imagesCmdAction(ctx *cli.Context) error {
+	images, err := image.ListImages()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	_, _ = fmt.Fprint(w, "REPOSITORY\tTAG\tIMAGE ID\tLAYERS\tSIZE\tCREATED\n")
+	for _, img := range images {
+		size, err := img.GetSize()
+		if err != nil {
+			return err
+		}
+		repoTags, _, err := getImageRepoTags(img.Id)
+		if err != nil {
+			return err
+		}
+		// 没有tag的镜像显示为 <none>
+		if len(repoTags) == 0 {
+			repoTags = []string{"<none>:<none>"}
+		}
+		for _, repoTag := range repoTags {
+			idx := strings.LastIndex(repoTag, ":")
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				repoTag[:idx],
+				repoTag[idx+1:],
+				img.GetShortId(),
+				len(img.Layers),
+				formatSize(size),
+				img.CreatedTime)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("tabwriter flush error %v", err)
+	}
+
+	return nil
+}
+
+// `mdocker rmi`命令主逻辑入口
+func rmiCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return fmt.Errorf("missing image name")
+	}
+
+	for _, imageRef := range ctx.Args() {
+		if err := removeImage(imageRef, ctx.Bool(imageFlagForce)); err != nil {
+			return fmt.Errorf("remove image %s error, %v", imageRef, err)
+		}
+	}
+
+	return nil
+}
+
+// 删除镜像引用, 镜像不再被任何tag指向时删除镜像, 并清理不再被镜像和容器引用的layer
+// 使用镜像id删除时, 镜像存在多个tag需要指定force
+func removeImage(imageRef string, force bool) error {
+	img, err := image.ResolveImage(imageRef)
+	if err != nil {
+		return err
+	}
+	repoTags, repoDigests, err := getImageRepoTags(img.Id)
+	if err != nil {
+		return err
+	}
+
+	// 使用引用删除且镜像还有其他tag时只删除该引用
+	ref, err := image.ParseReference(imageRef)
+	isReference := err == nil && (containsString(repoTags, ref.String()) || containsString(repoDigests, ref.String()))
+	if isReference && (len(repoTags) > 1 || (ref.Digest != "" && len(repoTags) > 0)) {
+		return untagImage(ref)
+	}
+	if !isReference && len(repoTags) > 1 && !force {
+		return fmt.Errorf("image is referenced in multiple repositories %v", repoTags)
+	}
+
+	containers, err := container_info.GetContainerInfoAll()
+	if err != nil {
+		return err
+	}
+	// 容器的lowerdir仍在使用的layer不能删除
+	var usedLayers []string
+	for _, item := range containers {
+		if item.ImageId == img.Id && !force {
+			return fmt.Errorf("image is being used by container %s", item.Name)
+		}
+		usedLayers = append(usedLayers, item.ImageLayers...)
+	}
+
+	if isReference {
+		if err = untagImage(ref); err != nil {
+			return err
+		}
+	}
+	if err = image.RemoveImage(img.Id); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted: %s\n", img.Id)
+
+	return image.PruneLayers(usedLayers)
+}
+
+// 删除镜像引用
+func untagImage(ref *image.Reference) error {
+	if _, err := image.RemoveReference(ref.String()); err != nil {
+		return err
+	}
+	fmt.Printf("Untagged: %s\n", ref)
+
+	return nil
+}
+
+// `mdocker tag`命令主逻辑入口
+func tagCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		return fmt.Errorf("missing source image or target image")
+	}
+
+	img, err := image.ResolveImage(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	return image.AddReference(ctx.Args().Get(1), img.Id)
+}
+
+// `mdocker image inspect`命令主逻辑入口
+func imageInspectAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return fmt.Errorf("missing image name")
+	}
+
+	img, err := image.ResolveImage(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	size, err := img.GetSize()
+	if err != nil {
+		return err
+	}
+	configBytes, err := img.GetRawConfig()
+	if err != nil {
+		return err
+	}
+	repoTags, repoDigests, err := getImageRepoTags(img.Id)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(&imageInspectInfo{
+		Id:          img.Id,
+		RepoTags:    repoTags,
+		RepoDigests: repoDigests,
+		Layers:      img.Layers,
+		Size:        size,
+		CreatedTime: img.CreatedTime,
+		Config:      configBytes,
+	}, "", "    ")
+	if err != nil {
+		return fmt.Errorf("image info marshal error, %v", err)
+	}
+	fmt.Println(string(content))
+
+	return nil
+}
+
+// `mdocker image verify`命令主逻辑入口, 未指定镜像时校验所有镜像
+func imageVerifyAction(ctx *cli.Context) error {
+	var images []*image.Image
+	if len(ctx.Args()) == 0 {
+		var err error
+		if images, err = image.ListImages(); err != nil {
+			return err
+		}
+	}
+	for _, imageRef := range ctx.Args() {
+		img, err := image.ResolveImage(imageRef)
+		if err != nil {
+			return err
+		}
+		images = append(images, img)
+	}
+
+	failed := 0
+	for _, img := range images {
+		if err := image.VerifyImage(img); err != nil {
+			fmt.Printf("%s\tFAILED\t%v\n", img.GetShortId(), err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s\tOK\n", img.GetShortId())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed verification", failed, len(images))
+	}
+
+	return nil
+}
+
+// 获取镜像的引用, 分为 name:tag 和 name@digest 两类
+func getImageRepoTags(imageId string) ([]string, []string, error) {
+	refs, err := image.GetImageReferences(imageId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var repoTags, repoDigests []string
+	for _, ref := range refs {
+		if strings.Contains(ref, "@") {
+			repoDigests = append(repoDigests, ref)
+		} else {
+			repoTags = append(repoTags, ref)
+		}
+	}
+
+	return repoTags, repoDigests, nil
+}
+
+// 判断字符串列表中是否包含指定字符串
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 将字节数格式化为便于阅读的大小
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	idx := 0
+	for value >= 1024 && idx < len(units)-1 {
+		value /= 1024
+		idx++
+	}
+
+	return fmt.Sprintf("%.2f%s", value, units[idx])
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"docker/container/container_info"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+)
+
+var InspectCommand = cli.Command{
+	Name:   "inspect",
+	Usage:  "print the info of a container in json, mdocker inspect [container]",
+	Action: inspectCmdAction,
+}
+
+// mdocker inspect 命令逻辑入口
+func inspectCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return fmt.Errorf("missing container name")
+	}
+
+	cInfo, err := container_info.GetContainerInfoByContainerName(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(cInfo, "", "    ")
+	if err != nil {
+		return fmt.Errorf("container info marshal error, %v", err)
+	}
+	fmt.Println(string(content))
+
+	return nil
+}
@@ -1,55 +1,136 @@
 package cmd
 
 import (
-	"docker/config"
+	"docker/container/image"
 	"docker/utils"
 	"fmt"
 	"github.com/urfave/cli"
 	"os"
 	"os/exec"
-	"path"
+	"strings"
 )
 
 var LoadCommand = cli.Command{
-	Name:   "load",
-	Usage:  "load a image from tar pack",
+	Name:  "load",
+	Usage: "load a image from docker-archive, oci layout or rootfs tar pack, mdocker load [pack] [image]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  imageFlagFormat,
+			Usage: "image pack format, docker(default) or oci",
+		},
+	},
 	Action: loadCmdAction,
 }
 
 // mdocker load命令主逻辑入口
 func loadCmdAction(ctx *cli.Context) error {
-	if len(ctx.Args()) < 2 {
+	if len(ctx.Args()) < 1 {
 		return fmt.Errorf("invalid params")
 	}
 
 	imagePackPath := ctx.Args().Get(0)
 	imageName := ctx.Args().Get(1)
 
-	return loadImage(imagePackPath, imageName)
+	switch ctx.String(imageFlagFormat) {
+	case "", imageFormatDocker:
+		return loadImage(imagePackPath, imageName)
+	case imageFormatOCI:
+		return loadOCIImage(imagePackPath, imageName)
+	default:
+		return fmt.Errorf("unsupported image format %s", ctx.String(imageFlagFormat))
+	}
 }
 
-// 加载镜像
+// 加载镜像, 支持docker save导出的docker-archive格式以及docker export导出的rootfs tar包
 func loadImage(imagePackPath, imageName string) error {
-	imagePath := path.Join(config.PathImage, imageName)
-	pathExists, err := utils.GeneralUtils.IsDirExists(imagePath)
+	isDockerArchive, err := isDockerArchivePack(imagePackPath)
 	if err != nil {
-		return fmt.Errorf("image path existence judge fail, %v", err)
+		return err
+	}
+	if isDockerArchive {
+		return loadDockerArchive(imagePackPath, imageName)
 	}
-	if pathExists {
-		return fmt.Errorf("image already exists")
+
+	return loadRootfsPack(imagePackPath, imageName)
+}
+
+// 加载docker-archive格式镜像
+func loadDockerArchive(imagePackPath, imageName string) error {
+	archiveDir, err := os.MkdirTemp("", "mdocker-load-")
+	if err != nil {
+		return fmt.Errorf("tmp dir create error, %v", err)
+	}
+	defer os.RemoveAll(archiveDir)
+
+	// 解压镜像包
+	output, err := exec.Command("tar", "-xf", imagePackPath, "-C", archiveDir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("image pack untar error, %v, %s", err, output)
+	}
+
+	return image.LoadDockerArchive(archiveDir, imageName)
+}
+
+// 加载OCI image layout格式镜像, 支持layout目录以及打包后的layout tar包
+func loadOCIImage(layoutPath, imageName string) error {
+	isDir, err := utils.GeneralUtils.IsDirExists(layoutPath)
+	if err != nil {
+		return err
+	}
+	if isDir {
+		return image.LoadOCILayout(layoutPath, imageName)
+	}
+
+	layoutDir, err := os.MkdirTemp("", "mdocker-load-")
+	if err != nil {
+		return fmt.Errorf("tmp dir create error, %v", err)
 	}
+	defer os.RemoveAll(layoutDir)
 
-	// 创建image path
-	err = os.MkdirAll(imagePath, 0755)
+	output, err := exec.Command("tar", "-xf", layoutPath, "-C", layoutDir).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("image path mkdir error, %v", err)
+		return fmt.Errorf("oci archive untar error, %v, %s", err, output)
+	}
+
+	return image.LoadOCILayout(layoutDir, imageName)
+}
+
+// 加载rootfs tar包: 将tar包作为一个layer导入layer store, 并创建镜像manifest
+func loadRootfsPack(imagePackPath, imageName string) error {
+	if imageName == "" {
+		return fmt.Errorf("missing image name")
 	}
 
-	// 解压镜像
-	_, err = exec.Command("tar", "-xvf", imagePackPath, "-C", imagePath).CombinedOutput()
+	if _, err := image.ParseReference(imageName); err != nil {
+		return err
+	}
+
+	// 导入layer
+	digest, err := image.ImportLayer(imagePackPath)
 	if err != nil {
 		return fmt.Errorf("image load error, %v", err)
 	}
 
-	return nil
+	img, err := image.CreateImage([]string{digest}, nil)
+	if err != nil {
+		return fmt.Errorf("image create error, %v", err)
+	}
+
+	return image.AddReference(imageName, img.Id)
+}
+
+// 根据tar包中是否包含manifest.json判断是否为docker-archive格式
+func isDockerArchivePack(imagePackPath string) (bool, error) {
+	output, err := exec.Command("tar", "-tf", imagePackPath).Output()
+	if err != nil {
+		return false, fmt.Errorf("image pack list error, %v", err)
+	}
+
+	for _, entry := range strings.Split(string(output), "\n") {
+		if strings.TrimPrefix(entry, "./") == image.DockerArchiveManifestName {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"docker/container/container_init"
 	"github.com/urfave/cli"
 	"math/rand"
 	"time"
@@ -8,19 +9,63 @@ import (
 
 const (
 	// mdocker run 相关参数
-	runCmdFlagTty     = "ti"
-	runCmdFlagVolume  = "v"
-	runCmdFlagDetach  = "d"
-	runCmdFlagName    = "name"
-	runCmdFlagNetwork = "net"
-	runCmdFlagPortMap = "p"
+	runCmdFlagTty         = "ti"
+	runCmdFlagVolume      = "v"
+	runCmdFlagDetach      = "d"
+	runCmdFlagName        = "name"
+	runCmdFlagNetwork     = "net"
+	runCmdFlagPortMap     = "p"
+	runCmdFlagInit        = "init"
+	runCmdFlagEnv         = "e"
+	runCmdFlagEnvFile     = "env-file"
+	runCmdFlagUser        = "user"
+	runCmdFlagHostname    = "hostname"
+	runCmdFlagAddHost     = "add-host"
+	runCmdFlagDns         = "dns"
+	runCmdFlagDevice      = "device"
+	runCmdFlagReadonly    = "read-only"
+	runCmdFlagTmpfs       = "tmpfs"
+	runCmdFlagPrivileged  = "privileged"
+	runCmdFlagCapAdd      = "cap-add"
+	runCmdFlagCapDrop     = "cap-drop"
+	runCmdFlagSecurityOpt = "security-opt"
+	runCmdFlagUsernsRemap = "userns-remap"
+	runCmdFlagCgroupNs    = "cgroupns"
+
+	// mdocker exec 相关参数
+	execCmdFlagUser    = "user"
+	execCmdFlagTty     = "ti"
+	execCmdFlagCapAdd  = "cap-add"
+	execCmdFlagCapDrop = "cap-drop"
+	execCmdFlagWorkdir = "workdir"
 
 	// cgroup subsystem限制参数
 	runCmdCgroupMemory   = "m"
 	rumCmdCgroupCpuShare = "cpushare"
 	rumCmdCgroupCpuSet   = "cpuset"
+	runCmdCgroupCpus     = "cpus"
 
 	containerNameLength = 10
+
+	// 镜像导入导出相关参数
+	imageFlagFormat   = "format"
+	imageFormatDocker = "docker"
+	imageFormatOCI    = "oci"
+	imageFlagForce    = "force"
+
+	// mdocker commit 相关参数
+	commitFlagChange = "change"
+
+	// mdocker build 相关参数
+	buildFlagFile        = "f"
+	buildFlagTag         = "t"
+	buildFlagNoCache     = "no-cache"
+	defaultBuildFileName = "Dockerfile"
+
+	// mdocker pull/push 相关参数
+	registryFlagInsecure = "insecure"
+	registryFlagUsername = "username"
+	registryFlagPassword = "password"
 )
 
 var (
@@ -49,6 +94,71 @@ var (
 			Name:  runCmdFlagPortMap,
 			Usage: "port map",
 		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagEnv,
+			Usage: "set environment variables, e.g. -e KEY=VALUE",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagEnvFile,
+			Usage: "read environment variables from files, one KEY=VALUE per line",
+		},
+		cli.StringFlag{
+			Name:  runCmdFlagUser,
+			Usage: "username or uid, format: <name|uid>[:<group|gid>]",
+		},
+		cli.StringFlag{
+			Name:  runCmdFlagHostname,
+			Usage: "container host name, default the container id",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagAddHost,
+			Usage: "add a custom host-to-IP mapping, format: host:ip",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagDns,
+			Usage: "set custom dns servers, default the dns servers of the host",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagDevice,
+			Usage: "add a host device to the container, format: host-path[:container-path]",
+		},
+		cli.BoolFlag{
+			Name:  runCmdFlagReadonly,
+			Usage: "mount the container's root filesystem as read only",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagTmpfs,
+			Usage: "mount a tmpfs directory, format: path[:options], e.g. /tmp:size=64m,mode=1777",
+		},
+		cli.BoolFlag{
+			Name:  runCmdFlagPrivileged,
+			Usage: "give extended privileges to the container, /proc and /sys are not masked",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagCapAdd,
+			Usage: "add linux capabilities, e.g. NET_ADMIN or ALL",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagCapDrop,
+			Usage: "drop linux capabilities, e.g. NET_RAW or ALL",
+		},
+		cli.StringSliceFlag{
+			Name:  runCmdFlagSecurityOpt,
+			Usage: "security options, seccomp=unconfined or seccomp=<profile.json>",
+		},
+		cli.StringFlag{
+			Name:  runCmdFlagUsernsRemap,
+			Usage: "run the container in a user namespace mapped by /etc/subuid and /etc/subgid, format: user[:group]",
+		},
+		cli.StringFlag{
+			Name:  runCmdFlagCgroupNs,
+			Usage: "cgroup namespace to use, host or private",
+			Value: container_init.CgroupNsHost,
+		},
+		cli.BoolFlag{
+			Name:  runCmdFlagInit,
+			Usage: "run an init inside the container that forwards signals and reaps processes",
+		},
 		// cgroup subsystem flag
 		cli.StringFlag{
 			Name:  runCmdCgroupMemory,
@@ -62,6 +172,26 @@ var (
 			Name:  rumCmdCgroupCpuSet,
 			Usage: "cpuset limit",
 		},
+		cli.StringFlag{
+			Name:  runCmdCgroupCpus,
+			Usage: "number of cpus, e.g. 1.5",
+		},
+	}
+
+	registryCmdFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  registryFlagInsecure,
+			Usage: "access the registry over plain http",
+		},
+		cli.StringFlag{
+			Name:  registryFlagUsername,
+			Usage: "registry username",
+		},
+		cli.StringFlag{
+			Name:   registryFlagPassword,
+			Usage:  "registry password",
+			EnvVar: "MDOCKER_REGISTRY_PASSWORD",
+		},
 	}
 )
 
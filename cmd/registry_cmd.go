@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"docker/container/image"
+	"fmt"
+	"github.com/urfave/cli"
+)
+
+// PullCommand `mdocker pull`命令定义
+var PullCommand = cli.Command{
+	Name:   "pull",
+	Usage:  "pull an image from a registry, mdocker pull [name:tag|name@digest]",
+	Flags:  registryCmdFlags,
+	Action: pullCmdAction,
+}
+
+// PushCommand `mdocker push`命令定义
+var PushCommand = cli.Command{
+	Name:   "push",
+	Usage:  "push an image to a registry, mdocker push [name:tag]",
+	Flags:  registryCmdFlags,
+	Action: pushCmdAction,
+}
+
+// `mdocker pull`命令主逻辑入口
+func pullCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return fmt.Errorf("missing image name")
+	}
+
+	img, err := image.PullImage(ctx.Args().Get(0), getRegistryOptions(ctx))
+	if err != nil {
+		return err
+	}
+	fmt.Println(img.Id)
+
+	return nil
+}
+
+// `mdocker push`命令主逻辑入口
+func pushCmdAction(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return fmt.Errorf("missing image name")
+	}
+
+	return image.PushImage(ctx.Args().Get(0), getRegistryOptions(ctx))
+}
+
+// 从命令参数中读取registry访问参数
+func getRegistryOptions(ctx *cli.Context) *image.RegistryOptions {
+	return &image.RegistryOptions{
+		Insecure: ctx.Bool(registryFlagInsecure),
+		Username: ctx.String(registryFlagUsername),
+		Password: ctx.String(registryFlagPassword),
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"docker/config"
 	"docker/container/cgroups"
 	"docker/container/container_info"
 	"docker/container/container_init"
@@ -42,8 +43,10 @@ func removeContainer(containerName string) error {
 		return fmt.Errorf("container remove error, %v", err)
 	}
 
-	// 移除cgroup path
-	cgroups.RemoveContainerCgroup(containerName)
+	// 移除cgroup path, rootless模式下未创建cgroup
+	if !config.Rootless {
+		cgroups.RemoveContainerCgroup(containerName)
+	}
 	// 移除文件系统
 	if err = container_init.DeleteWorkSpace(containerInfo.Name, containerInfo.Volume); err != nil {
 		return err
@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"docker/config"
 	"docker/container/cgroups"
 	"docker/container/cgroups/subsystems"
 	"docker/container/container_info"
 	"docker/container/container_init"
+	"docker/container/image"
 	"docker/container/network"
+	"docker/container/seccomp"
 	"docker/utils"
 	"fmt"
 	"github.com/urfave/cli"
+	"net"
 	"os"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,7 +25,7 @@ import (
 var RunCommand = cli.Command{
 	Name: "run",
 	Usage: `Create a container with namespace and cGroups limit
-			docker run -ti [command]`,
+			docker run -ti [image] [command]`,
 	Flags:  runCmdFlags,
 	Action: runCmdAction,
 }
@@ -27,7 +33,7 @@ var RunCommand = cli.Command{
 // run 命令逻辑入口
 func runCmdAction(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
-		return fmt.Errorf("container command missing")
+		return fmt.Errorf("container image missing")
 	}
 
 	// run命令参数校验
@@ -50,6 +56,36 @@ func validRunCmdFlags(ctx *cli.Context) error {
 	if ctx.Bool("ti") && ctx.Bool("d") {
 		return fmt.Errorf("ti and d param both set")
 	}
+	for _, extraHost := range ctx.StringSlice(runCmdFlagAddHost) {
+		if _, _, err := container_init.ParseExtraHost(extraHost); err != nil {
+			return err
+		}
+	}
+	for _, dns := range ctx.StringSlice(runCmdFlagDns) {
+		if net.ParseIP(dns) == nil {
+			return fmt.Errorf("invalid dns server %q", dns)
+		}
+	}
+
+	if ctx.IsSet(runCmdCgroupCpus) {
+		if _, err := subsystems.CpuQuota(ctx.String(runCmdCgroupCpus)); err != nil {
+			return err
+		}
+	}
+	if cgroupNs := ctx.String(runCmdFlagCgroupNs); cgroupNs != container_init.CgroupNsHost &&
+		cgroupNs != container_init.CgroupNsPrivate {
+		return fmt.Errorf("invalid cgroupns %q, host or private", cgroupNs)
+	}
+
+	// rootless模式下没有配置宿主机网络和cgroup的权限, 容器固定运行在当前用户映射的user namespace中
+	if config.Rootless {
+		for _, flagName := range []string{runCmdFlagNetwork, runCmdFlagPortMap, runCmdFlagUsernsRemap,
+			runCmdCgroupMemory, rumCmdCgroupCpuShare, rumCmdCgroupCpuSet, runCmdCgroupCpus} {
+			if ctx.IsSet(flagName) {
+				return fmt.Errorf("%s is not supported in rootless mode", flagName)
+			}
+		}
+	}
 
 	return nil
 }
@@ -70,24 +106,126 @@ func run(ctx *cli.Context) error {
 		return err
 	}
 
+	// 读取镜像及镜像config, 确定容器实际执行的命令
+	img, err := image.ResolveImage(imageName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := img.GetConfig()
+	if err != nil {
+		return err
+	}
+	containerConf := &imageConfig.Config
+	cmdArr, err = resolveContainerCommand(containerConf, cmdArr)
+	if err != nil {
+		return err
+	}
+	if ctx.IsSet(runCmdFlagUser) {
+		containerConf.User = ctx.String(runCmdFlagUser)
+	}
+	// 用户指定的环境变量覆盖镜像定义的同名环境变量
+	if containerConf.Env, err = mergeContainerEnv(ctx, containerConf.Env); err != nil {
+		return err
+	}
+	initConf := container_init.NewInitConfig(cmdArr, containerConf, id)
+	initConf.Init = ctx.Bool(runCmdFlagInit)
+	for _, deviceSpec := range ctx.StringSlice(runCmdFlagDevice) {
+		device, err := container_init.ParseDevice(deviceSpec)
+		if err != nil {
+			return err
+		}
+		initConf.Devices = append(initConf.Devices, *device)
+	}
+	for _, tmpfsSpec := range ctx.StringSlice(runCmdFlagTmpfs) {
+		mount, err := container_init.ParseTmpfsMount(tmpfsSpec)
+		if err != nil {
+			return err
+		}
+		initConf.Mounts = append(initConf.Mounts, *mount)
+	}
+	initConf.Readonly = ctx.Bool(runCmdFlagReadonly)
+	if initConf.Seccomp, err = seccomp.ParseSecurityOpt(ctx.StringSlice(runCmdFlagSecurityOpt)); err != nil {
+		return err
+	}
+	if ctx.Bool(runCmdFlagPrivileged) {
+		initConf.SetPrivileged()
+	}
+	initConf.Capabilities, err = container_init.ResolveCapabilities(initConf.Capabilities,
+		ctx.StringSlice(runCmdFlagCapAdd), ctx.StringSlice(runCmdFlagCapDrop))
+	if err != nil {
+		return err
+	}
+	if ctx.IsSet(runCmdFlagHostname) {
+		initConf.Hostname = ctx.String(runCmdFlagHostname)
+	}
+
+	if err = initConf.SetRootlessRootfs(containerName, img.Layers, ctx.String(runCmdFlagVolume)); err != nil {
+		return err
+	}
+
+	// 容器root映射为宿主机subuid/subgid中的普通用户
+	var idMappings *container_init.IdMappings
+	if ctx.IsSet(runCmdFlagUsernsRemap) {
+		if idMappings, err = container_init.ParseUsernsRemap(ctx.String(runCmdFlagUsernsRemap)); err != nil {
+			return err
+		}
+	}
+
 	// 使用init初始化容器, 初始化完成后在容器内执行用户命令
 	volume := ctx.String(runCmdFlagVolume)
-	initCmd, initPipe, err := container_init.NewContainerProcess(ctx.Bool(runCmdFlagTty), volume, containerName, imageName)
+	initCmd, initPipe, err := container_init.NewContainerProcess(ctx.Bool(runCmdFlagTty), volume, containerName,
+		img.Layers, idMappings)
 	if err != nil {
 		return err
 	}
-	if err = initCmd.Start(); err != nil {
+	// 由nsenter在init进程的go runtime启动之前创建cgroup namespace
+	privateCgroupNs := ctx.String(runCmdFlagCgroupNs) == container_init.CgroupNsPrivate
+	if privateCgroupNs {
+		initCmd.Env = append(initCmd.Env, config.EnvInitCgroupNs+"=1")
+	}
+	// ti模式下由init进程使用容器的devpts创建伪终端
+	var consoleSocket *os.File
+	if ctx.Bool(runCmdFlagTty) {
+		var childSocket *os.File
+		if consoleSocket, childSocket, err = container_init.NewConsoleSocket(); err != nil {
+			return err
+		}
+		defer consoleSocket.Close()
+		initCmd.ExtraFiles = append(initCmd.ExtraFiles, childSocket)
+		initConf.Terminal = true
+	}
+	err = initCmd.Start()
+	for _, file := range initCmd.ExtraFiles {
+		_ = file.Close()
+	}
+	if err != nil {
 		return err
 	}
 	// 构造containerInfo
 	cInfo := &container_info.ContainerInfo{
-		Id:          id,
-		Pid:         strconv.Itoa(initCmd.Process.Pid),
-		Command:     strings.Join(ctx.Args(), ""),
-		CreatedTime: time.Now().Format("2006-01-02 15:04:05"),
-		Name:        containerName,
-		Volume:      volume,
+		Id:           id,
+		Pid:          strconv.Itoa(initCmd.Process.Pid),
+		Command:      strings.Join(cmdArr, " "),
+		CreatedTime:  time.Now().Format("2006-01-02 15:04:05"),
+		Name:         containerName,
+		Volume:       volume,
+		Env:          initConf.Env,
+		User:         initConf.User,
+		Cwd:          initConf.Cwd,
+		Capabilities: initConf.Capabilities,
+		SecurityOpt:  ctx.StringSlice(runCmdFlagSecurityOpt),
+		Privileged:   ctx.Bool(runCmdFlagPrivileged),
+		UsernsRemap:  ctx.String(runCmdFlagUsernsRemap),
+		CgroupNs:     ctx.String(runCmdFlagCgroupNs),
+		Hostname:     initConf.Hostname,
+		Image:        imageName,
+		ImageId:      img.Id,
+		ImageLayers:  img.Layers,
+	}
+	for port := range containerConf.ExposedPorts {
+		cInfo.ExposedPorts = append(cInfo.ExposedPorts, port)
 	}
+	sort.Strings(cInfo.ExposedPorts)
 	if ctx.IsSet(runCmdFlagPortMap) {
 		cInfo.PortMap = ctx.StringSlice(runCmdFlagPortMap)
 	}
@@ -109,31 +247,138 @@ func run(ctx *cli.Context) error {
 		return err
 	}
 
-	// 将用户命令指定命令通过pipe传递给init进程
-	err = sendInitCommandParams(cmdArr, initPipe)
+	// 保存seccomp配置, exec进入容器的进程使用相同的配置
+	if initConf.Seccomp != nil {
+		profilePath := path.Join(container_info.GetContainerInfoDirPath(containerName), seccomp.ProfileFileName)
+		if err = seccomp.SaveProfile(profilePath, initConf.Seccomp); err != nil {
+			return err
+		}
+	}
+
+	// 生成容器的hosts, resolv.conf和hostname, 需要在分配容器ip之后生成
+	networkMounts, err := container_init.SetupNetworkFiles(containerName, &container_init.NetworkFilesConfig{
+		Hostname:   initConf.Hostname,
+		IpAddr:     cInfo.IpAddr,
+		ExtraHosts: ctx.StringSlice(runCmdFlagAddHost),
+		Dns:        ctx.StringSlice(runCmdFlagDns),
+	})
+	if err != nil {
+		return err
+	}
+	initConf.Mounts = append(initConf.Mounts, networkMounts...)
+	// 在 /sys/fs/cgroup 挂载容器的cgroup, 需要在init进程加入容器cgroup之后生成
+	cgroupMounts, err := container_init.CgroupMounts(initCmd.Process.Pid, privateCgroupNs, !ctx.Bool(runCmdFlagPrivileged))
 	if err != nil {
 		return err
 	}
+	initConf.Mounts = append(initConf.Mounts, cgroupMounts...)
+	if idMappings != nil {
+		if err = container_init.AllowContainerInfoAccess(containerName); err != nil {
+			return err
+		}
+	}
+
+	// 将用户命令及容器运行参数通过pipe传递给init进程
+	if err = container_init.SendInitConfig(initConf, initPipe); err != nil {
+		return err
+	}
 
-	// 当设置了ti参数时, 等待init进程退出
+	// 当设置了ti参数时, 连接伪终端并等待init进程退出
 	if ctx.Bool(runCmdFlagTty) {
+		console, err := container_init.ReceiveConsole(consoleSocket)
+		if err != nil {
+			_ = initCmd.Wait()
+			return err
+		}
+		detachConsole := container_init.AttachConsole(console)
 		_ = initCmd.Wait()
+		detachConsole()
 	}
 
 	return nil
 }
 
-// 解析命令行参数
+// 解析命令行参数, 返回镜像名和用户指定的命令(可以为空)
 func parseCmdArg(args []string) (string, []string, error) {
-	if len(args) < 2 {
+	if len(args) < 1 {
 		return "", nil, fmt.Errorf("invalid args")
 	}
 
 	return args[0], args[1:], nil
 }
 
+// 结合镜像的Entrypoint/Cmd确定容器执行的命令, 用户指定的命令会替换镜像的Cmd
+func resolveContainerCommand(containerConf *image.ContainerConfig, cmdArr []string) ([]string, error) {
+	if len(cmdArr) == 0 {
+		cmdArr = containerConf.Cmd
+	}
+
+	command := append(append([]string{}, containerConf.Entrypoint...), cmdArr...)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command specified")
+	}
+
+	return command, nil
+}
+
+// 按 镜像Env, --env-file, -e 的顺序合并环境变量, 后者覆盖前者的同名变量
+// 只指定变量名时使用宿主机上同名变量的值, 宿主机未设置时忽略
+func mergeContainerEnv(ctx *cli.Context, imageEnv []string) ([]string, error) {
+	env := append([]string{}, imageEnv...)
+
+	var overrides []string
+	for _, envFile := range ctx.StringSlice(runCmdFlagEnvFile) {
+		fileEnv, err := readEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, fileEnv...)
+	}
+	overrides = append(overrides, ctx.StringSlice(runCmdFlagEnv)...)
+
+	for _, item := range overrides {
+		if strings.HasPrefix(item, "=") {
+			return nil, fmt.Errorf("invalid env %q, missing variable name", item)
+		}
+		if !strings.Contains(item, "=") {
+			value, exist := os.LookupEnv(item)
+			if !exist {
+				continue
+			}
+			item += "=" + value
+		}
+		env = image.SetEnv(env, item)
+	}
+
+	return env, nil
+}
+
+// 读取env文件, 忽略空行和 # 开头的注释行
+func readEnvFile(envFile string) ([]string, error) {
+	content, err := os.ReadFile(envFile)
+	if err != nil {
+		return nil, fmt.Errorf("env file read error, %v", err)
+	}
+
+	var env []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		env = append(env, line)
+	}
+
+	return env, nil
+}
+
 // handle init cgroup configuration for the container
+// rootless模式下不创建cgroup, 返回nil
 func handleCgroupSet(pid int, containerName string, ctx *cli.Context) (*cgroups.CgroupManager, error) {
+	if config.Rootless {
+		return nil, nil
+	}
+
 	cgroupManager := cgroups.NewCgroupManager(containerName)
 	// set cgroup resource limit config
 	if err := cgroupManager.Set(getResourceConfFromCtx(ctx)); err != nil {
@@ -154,30 +399,19 @@ func getResourceConfFromCtx(ctx *cli.Context) *subsystems.ResourceConfig {
 		MemoryLimit: ctx.String(runCmdCgroupMemory),
 		CpuSet:      ctx.String(rumCmdCgroupCpuSet),
 		CpuShare:    ctx.String(rumCmdCgroupCpuShare),
+		Cpus:        ctx.String(runCmdCgroupCpus),
 	}
 }
 
-// write the command param array to the writing pipe
-func sendInitCommandParams(commandArr []string, initPipe *os.File) error {
-	commandStr := strings.Join(commandArr, " ")
-	if _, err := initPipe.WriteString(commandStr); err != nil {
-		return err
-	}
-
-	if err := initPipe.Close(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // mdocker run进程退出时触发动作
 func containerExitProcess(cgroupManager *cgroups.CgroupManager, ctx *cli.Context, cInfo *container_info.ContainerInfo) {
 	if ctx.Bool(runCmdFlagTty) { // 非后台运行container, 退出后删除容器信息
 		// 清除容器fs
 		_ = container_init.DeleteWorkSpace(cInfo.Name, ctx.String(runCmdFlagVolume))
 		// 删除cgroup
-		cgroupManager.Destroy()
+		if cgroupManager != nil {
+			cgroupManager.Destroy()
+		}
 
 		// 清除容器网络环境
 		_ = network.NetworkManager.DisConnect(cInfo)
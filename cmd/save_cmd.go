@@ -2,16 +2,26 @@ package cmd
 
 import (
 	"docker/config"
+	"docker/container/image"
 	"docker/utils"
 	"fmt"
 	"github.com/urfave/cli"
+	"os"
 	"os/exec"
 	"path"
+	"strings"
 )
 
 var SaveCommand = cli.Command{
-	Name:   "save",
-	Usage:  "save a container into image",
+	Name: "save",
+	Usage: `save a container into image tar, mdocker save [container] [path]
+			or export an image as oci layout, mdocker save --format oci [image] [path]`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  imageFlagFormat,
+			Usage: "image pack format, docker(default) or oci",
+		},
+	},
 	Action: saveCmdAction,
 }
 
@@ -21,10 +31,14 @@ func saveCmdAction(ctx *cli.Context) error {
 		return fmt.Errorf("invalid params")
 	}
 
-	containerName := ctx.Args().Get(0)
-	imagePath := ctx.Args().Get(1)
-
-	return saveContainerIntoTar(containerName, imagePath)
+	switch ctx.String(imageFlagFormat) {
+	case "", imageFormatDocker:
+		return saveContainerIntoTar(ctx.Args().Get(0), ctx.Args().Get(1))
+	case imageFormatOCI:
+		return saveImageIntoOCILayout(ctx.Args().Get(0), ctx.Args().Get(1))
+	default:
+		return fmt.Errorf("unsupported image format %s", ctx.String(imageFlagFormat))
+	}
 }
 
 // 将指定容器打包成tar
@@ -50,3 +64,27 @@ func saveContainerIntoTar(containerName, imagePath string) error {
 
 	return err
 }
+
+// 将镜像导出为OCI image layout, 输出路径以.tar结尾时打包为tar, 否则输出为目录
+func saveImageIntoOCILayout(imageName, outputPath string) error {
+	if !strings.HasSuffix(outputPath, ".tar") {
+		return image.SaveOCILayout(imageName, outputPath)
+	}
+
+	layoutDir, err := os.MkdirTemp("", "mdocker-save-")
+	if err != nil {
+		return fmt.Errorf("tmp dir create error, %v", err)
+	}
+	defer os.RemoveAll(layoutDir)
+
+	if err = image.SaveOCILayout(imageName, layoutDir); err != nil {
+		return err
+	}
+
+	output, err := exec.Command("tar", "-cf", outputPath, "-C", layoutDir, ".").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("oci archive tar error, %v, %s", err, output)
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
 	"syscall"
 )
 
@@ -11,10 +15,9 @@ const (
 
 	ProcessMountInfoPath = "/proc/self/mountinfo"
 
-	PathMnt       = "/var/lib/mdocker/overlay2/mnt"
-	PathReadWrite = "/var/lib/mdocker/overlay2/rw"
-	PathImage     = "/var/lib/mdocker/overlay2/image"
-	PathWorkDir   = "/var/lib/mdocker/overlay2/workdir"
+	// root用户使用的数据目录和运行时目录
+	PathDefaultDataRoot = "/var/lib/mdocker"
+	PathDefaultRunRoot  = "/var/run/mdocker"
 
 	ProcessCloneFlags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWUTS |
 		syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC
@@ -24,5 +27,84 @@ const (
 
 	// exec 命令相关环境变量
 	EnvExecPid = "mdocker_pid"
-	EnvExecCmd = "mdocker_cmd"
+	// run 命令使用独立cgroup namespace时设置的环境变量
+	EnvInitCgroupNs = "mdocker_cgroupns"
+
+	// 镜像未指定PATH时容器使用的默认PATH
+	DefaultPathEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+var (
+	// Rootless 非root用户运行时为rootless模式, 容器运行在user namespace中, 不支持网络和cgroup限制
+	Rootless = os.Geteuid() != 0
+
+	// 数据目录和运行时目录, rootless模式下使用 $XDG_DATA_HOME/mdocker 和 $XDG_RUNTIME_DIR/mdocker
+	PathDataRoot, errDataRoot = getDataRoot()
+	PathRunRoot               = getRunRoot()
+
+	PathMnt       = path.Join(PathDataRoot, "overlay2/mnt")
+	PathReadWrite = path.Join(PathDataRoot, "overlay2/rw")
+	PathImage     = path.Join(PathDataRoot, "overlay2/image")
+	PathWorkDir   = path.Join(PathDataRoot, "overlay2/workdir")
+	PathLayer     = path.Join(PathDataRoot, "overlay2/layers")
+
+	PathImageRepositories = path.Join(PathDataRoot, "overlay2/repositories.json")
+
+	PathBuildCache = path.Join(PathDataRoot, "build-cache")
 )
+
+// CheckRootDirs 检查数据目录和运行时目录是否可用, 在执行命令前调用
+func CheckRootDirs() error {
+	if !Rootless {
+		return nil
+	}
+	if errDataRoot != nil {
+		return errDataRoot
+	}
+	// 默认的运行时目录由登录会话创建, 只使用当前用户所有的目录, 避免使用其他用户预先创建的目录或符号链接
+	if os.Getenv("XDG_RUNTIME_DIR") == "" {
+		runtimeDir := path.Dir(PathRunRoot)
+		info, err := os.Lstat(runtimeDir)
+		if err != nil {
+			return fmt.Errorf("runtime dir %s error, %v, please set XDG_RUNTIME_DIR", runtimeDir, err)
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !info.IsDir() || !ok || int(stat.Uid) != os.Geteuid() {
+			return fmt.Errorf("runtime dir %s is not a directory owned by current user, please set XDG_RUNTIME_DIR", runtimeDir)
+		}
+	}
+
+	return nil
+}
+
+// 获取数据目录, XDG_DATA_HOME未设置时使用 ~/.local/share, HOME也未设置时返回错误
+func getDataRoot() (string, error) {
+	if !Rootless {
+		return PathDefaultDataRoot, nil
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("rootless data dir unknown, please set XDG_DATA_HOME or HOME")
+		}
+		dataHome = path.Join(homeDir, ".local/share")
+	}
+
+	return path.Join(dataHome, "mdocker"), nil
+}
+
+// 获取运行时目录, XDG_RUNTIME_DIR未设置时使用 /run/user/{uid}
+func getRunRoot() string {
+	if !Rootless {
+		return PathDefaultRunRoot
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = path.Join("/run/user", strconv.Itoa(os.Geteuid()))
+	}
+
+	return path.Join(runtimeDir, "mdocker")
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 )
 
+// CgroupManager 管理容器的cgroup, 根据宿主机自动选择cgroup v1的各subsystem层级或v2的统一层级
 type CgroupManager struct {
 	// ContainerName the relative path of cgroup node in the hierachy
 	ContainerName string
@@ -22,6 +23,10 @@ func NewCgroupManager(path string) *CgroupManager {
 
 // Apply adding a PID into every cgroup in the cgroup list
 func (c *CgroupManager) Apply(pid int) error {
+	if IsCgroupV2() {
+		return (&unifiedCgroup{containerName: c.ContainerName}).Apply(pid)
+	}
+
 	var err error
 	for _, subSysIns := range subsystems.SubsystemsIns {
 		err = subSysIns.Apply(c.ContainerName, pid)
@@ -35,6 +40,10 @@ func (c *CgroupManager) Apply(pid int) error {
 
 // Set set the resource limit config of the cgroup manager
 func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
+	if IsCgroupV2() {
+		return (&unifiedCgroup{containerName: c.ContainerName}).Set(res)
+	}
+
 	var err error
 	for _, subSysIns := range subsystems.SubsystemsIns {
 		err = subSysIns.Set(c.ContainerName, res)
@@ -48,6 +57,13 @@ func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
 
 // Destroy Remove all the cgroup created by the manager
 func (c *CgroupManager) Destroy() {
+	if IsCgroupV2() {
+		if err := (&unifiedCgroup{containerName: c.ContainerName}).Remove(); err != nil {
+			utils.LoggerUtil.Errorf("remove cgroup fail %v", err)
+		}
+		return
+	}
+
 	for _, subSysIns := range subsystems.SubsystemsIns {
 		if err := subSysIns.Remove(c.ContainerName); err != nil {
 			utils.LoggerUtil.Errorf("remove cgroup fail %v", err)
@@ -57,6 +73,13 @@ func (c *CgroupManager) Destroy() {
 
 // 删除容器的cgroup目录
 func RemoveContainerCgroup(containerName string) {
+	if IsCgroupV2() {
+		if err := (&unifiedCgroup{containerName: containerName}).Remove(); err != nil && !os.IsNotExist(err) {
+			utils.LoggerUtil.Errorf("remove cgroup fail %v", err)
+		}
+		return
+	}
+
 	for _, subSysIns := range subsystems.SubsystemsIns {
 		if err := subSysIns.Remove(containerName); err != nil && !os.IsNotExist(err) {
 			utils.LoggerUtil.Errorf("remove cgroup fail %v", err)
@@ -0,0 +1,157 @@
+package cgroups
+
+import (
+	"docker/config"
+	"docker/container/cgroups/subsystems"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// cgroup v2统一层级的挂载点
+	unifiedMountPoint = "/sys/fs/cgroup"
+	// cgroup2文件系统的magic number
+	cgroup2SuperMagic = 0x63677270
+)
+
+// 容器使用的cgroup v2 controller
+var unifiedControllers = []string{"cpu", "cpuset", "memory"}
+
+// IsCgroupV2 判断宿主机是否只使用cgroup v2统一层级, 即 /sys/fs/cgroup 挂载为cgroup2
+// 同时挂载了cgroup v1和v2的混合模式下, controller位于v1层级中, 仍然使用v1
+func IsCgroupV2() bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(unifiedMountPoint, &stat); err != nil {
+		return false
+	}
+
+	return stat.Type == cgroup2SuperMagic
+}
+
+// cgroup v2下容器的cgroup, 所有controller的配置位于同一个目录 {mountPoint}/mdocker/{containerName}
+type unifiedCgroup struct {
+	containerName string
+}
+
+// 设置容器的资源限制, cgroup目录不存在时自动创建
+func (u *unifiedCgroup) Set(res *subsystems.ResourceConfig) error {
+	cgroupPath, err := u.create()
+	if err != nil {
+		return err
+	}
+
+	if res.MemoryLimit != "" {
+		if err = writeCgroupFile(cgroupPath, "memory.max", res.MemoryLimit); err != nil {
+			return err
+		}
+	}
+	if res.CpuShare != "" {
+		weight, err := cpuSharesToWeight(res.CpuShare)
+		if err != nil {
+			return err
+		}
+		if err = writeCgroupFile(cgroupPath, "cpu.weight", strconv.FormatUint(weight, 10)); err != nil {
+			return err
+		}
+	}
+	if res.Cpus != "" {
+		quota, err := subsystems.CpuQuota(res.Cpus)
+		if err != nil {
+			return err
+		}
+		if err = writeCgroupFile(cgroupPath, "cpu.max", fmt.Sprintf("%d %d", quota, subsystems.CpuPeriod)); err != nil {
+			return err
+		}
+	}
+	if res.CpuSet != "" {
+		if err = writeCgroupFile(cgroupPath, "cpuset.cpus", res.CpuSet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 将进程加入容器的cgroup
+func (u *unifiedCgroup) Apply(pid int) error {
+	return writeCgroupFile(u.path(), "cgroup.procs", strconv.Itoa(pid))
+}
+
+// 删除容器的cgroup目录, cgroup目录中的控制文件无法删除, 只能删除目录本身
+func (u *unifiedCgroup) Remove() error {
+	return os.Remove(u.path())
+}
+
+// 创建容器的cgroup目录, 并在上级目录中开启容器需要的controller
+func (u *unifiedCgroup) create() (string, error) {
+	rootPath := path.Join(unifiedMountPoint, config.CgroupRoot)
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return "", fmt.Errorf("cgroup create error %v", err)
+	}
+	// 子cgroup只能使用上级cgroup的subtree_control中开启的controller
+	for _, parentPath := range []string{unifiedMountPoint, rootPath} {
+		if err := enableControllers(parentPath); err != nil {
+			return "", err
+		}
+	}
+
+	cgroupPath := u.path()
+	if err := os.Mkdir(cgroupPath, 0755); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("cgroup create error %v", err)
+	}
+
+	return cgroupPath, nil
+}
+
+// 获取容器的cgroup目录
+func (u *unifiedCgroup) path() string {
+	return path.Join(unifiedMountPoint, config.CgroupRoot, u.containerName)
+}
+
+// 在cgroup的subtree_control中开启可用的controller
+func enableControllers(cgroupPath string) error {
+	content, err := os.ReadFile(path.Join(cgroupPath, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("read cgroup controllers error, %v", err)
+	}
+	available := strings.Fields(string(content))
+
+	var controls []string
+	for _, controller := range unifiedControllers {
+		for _, item := range available {
+			if item == controller {
+				controls = append(controls, "+"+controller)
+				break
+			}
+		}
+	}
+	if len(controls) == 0 {
+		return nil
+	}
+
+	return writeCgroupFile(cgroupPath, "cgroup.subtree_control", strings.Join(controls, " "))
+}
+
+// cpu.shares(2-262144)按比例转换为cpu.weight(1-10000), 与runc的转换方式一致
+func cpuSharesToWeight(cpuShares string) (uint64, error) {
+	shares, err := strconv.ParseUint(cpuShares, 10, 64)
+	if err != nil || shares < 2 || shares > 262144 {
+		return 0, fmt.Errorf("invalid cpushare %q", cpuShares)
+	}
+
+	return 1 + ((shares-2)*9999)/262142, nil
+}
+
+// 写入cgroup控制文件
+func writeCgroupFile(cgroupPath, fileName, content string) error {
+	filePath := path.Join(cgroupPath, fileName)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("cgroup %s write fail: %v", filePath, err)
+	}
+
+	return nil
+}
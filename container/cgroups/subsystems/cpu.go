@@ -1,6 +1,9 @@
 package subsystems
 
-import "path"
+import (
+	"path"
+	"strconv"
+)
 
 type CpuSubSystem struct {
 }
@@ -11,11 +14,25 @@ func (s *CpuSubSystem) Set(containerName string, res *ResourceConfig) error {
 		return err
 	}
 
-	if res.CpuShare == "" {
+	if res.CpuShare != "" {
+		if err = writeSubsystemFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(res.CpuShare), 0644); err != nil {
+			return err
+		}
+	}
+
+	if res.Cpus == "" {
 		return nil
 	}
+	quota, err := CpuQuota(res.Cpus)
+	if err != nil {
+		return err
+	}
+	err = writeSubsystemFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(CpuPeriod)), 0644)
+	if err != nil {
+		return err
+	}
 
-	return writeSubsystemFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(res.CpuShare), 0644)
+	return writeSubsystemFile(path.Join(subsysCgroupPath, "cpu.cfs_quota_us"), []byte(strconv.FormatInt(quota, 10)), 0644)
 }
 
 func (s *CpuSubSystem) Remove(containerName string) error {
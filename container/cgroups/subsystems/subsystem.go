@@ -5,6 +5,7 @@ type ResourceConfig struct {
 	MemoryLimit string
 	CpuShare    string
 	CpuSet      string
+	Cpus        string // 可使用的cpu数量, 如 1.5, 转换为cfs配额
 }
 
 // Subsystem the interface proto of subsystem
@@ -19,6 +20,12 @@ type Subsystem interface {
 	Remove(path string) error
 }
 
+// CpuPeriod cfs调度周期(微秒), 与docker保持一致
+const CpuPeriod = 100000
+
+// MinCpus 可限制的最小cpu数量, 对应内核允许的最小cfs配额1000微秒
+const MinCpus = 0.01
+
 var (
 	SubsystemsIns = []Subsystem{
 		&CpusetSubSystem{},
@@ -91,3 +91,16 @@ func applyPidToCgroup(subsysName, containerName string, pid int, perm fs.FileMod
 		path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), perm,
 	)
 }
+
+// CpuQuota 将cpu数量转换为每个cfs周期内可使用的cpu时间(微秒)
+func CpuQuota(cpus string) (int64, error) {
+	value, err := strconv.ParseFloat(cpus, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid cpus %q", cpus)
+	}
+	if value < MinCpus {
+		return 0, fmt.Errorf("invalid cpus %q, minimum is %v", cpus, MinCpus)
+	}
+
+	return int64(value * CpuPeriod), nil
+}
@@ -21,7 +21,7 @@ func RecordContainerInfo(containerInfo *ContainerInfo) error {
 
 	// 写入container info json file
 	infoDirPath := GetContainerInfoDirPath(containerInfo.Name)
-	if err = os.MkdirAll(infoDirPath, 0622); err != nil {
+	if err = os.MkdirAll(infoDirPath, 0755); err != nil {
 		return fmt.Errorf("container info mkdir error, %v", err)
 	}
 	infoFileName := path.Join(infoDirPath, ContainerConfigName)
@@ -82,6 +82,9 @@ func GetContainerInfoAll() ([]*ContainerInfo, error) {
 	containerInfoDir := ContainerInfoLocation
 	files, err := ioutil.ReadDir(containerInfoDir)
 	if err != nil {
+		if os.IsNotExist(err) { // 尚未创建过容器
+			return nil, nil
+		}
 		return nil, fmt.Errorf("read dir %s error %v", containerInfoDir, err)
 	}
 
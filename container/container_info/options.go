@@ -1,5 +1,10 @@
 package container_info
 
+import (
+	"docker/config"
+	"path"
+)
+
 type ContainerInfo struct {
 	Pid         string   `json:"pid"`
 	Id          string   `json:"id"`
@@ -10,12 +15,34 @@ type ContainerInfo struct {
 	Volume      string   `json:"volume"`
 	PortMap     []string `json:"port_map"`
 	IpAddr      string   `json:"ip_addr"`
+	Hostname    string   `json:"hostname"`
+	// 容器用户进程的环境变量和运行用户
+	Env  []string `json:"env"`
+	User string   `json:"user"`
+	// 容器用户进程的工作目录, exec未指定工作目录时使用
+	Cwd string `json:"cwd"`
+	// 容器用户进程保留的capability
+	Capabilities []string `json:"capabilities"`
+	SecurityOpt  []string `json:"security_opt"`
+	Privileged   bool     `json:"privileged"`
+	// 容器user namespace映射使用的宿主机用户, 为空时不创建user namespace
+	UsernsRemap string `json:"userns_remap"`
+	// 容器的cgroup namespace模式, host或private
+	CgroupNs string `json:"cgroupns"`
+	// 镜像声明的对外暴露端口, 如 80/tcp
+	ExposedPorts []string `json:"exposed_ports"`
+	// 容器使用的镜像引用和镜像id, 以及作为lowerdir挂载的镜像layer
+	Image       string   `json:"image"`
+	ImageId     string   `json:"image_id"`
+	ImageLayers []string `json:"image_layers"`
 }
 
+// ContainerInfoLocation 容器信息存放目录
+var ContainerInfoLocation = path.Join(config.PathRunRoot, "containers")
+
 const (
-	ContainerInfoLocation = "/var/run/mdocker/containers/"
-	ContainerConfigName   = "config.json"
-	ContainerLogFileName  = "container.log"
+	ContainerConfigName  = "config.json"
+	ContainerLogFileName = "container.log"
 
 	// container 状态
 	StatusRunning = "running"
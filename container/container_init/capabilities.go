@@ -0,0 +1,259 @@
+package container_init
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	capabilityPrefix = "CAP_"
+	capabilityAll    = "ALL"
+
+	// capset(2) 使用的版本, 支持64位capability
+	linuxCapabilityVersion3 = 0x20080522
+
+	// 内核支持的最大capability编号
+	capLastCapPath = "/proc/sys/kernel/cap_last_cap"
+)
+
+// capability名称与编号, 与 linux/capability.h 一致
+var capabilityNumbers = map[string]uint{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// 容器默认的capability, 与docker保持一致
+// 没有devices cgroup限制可访问的设备, 不保留CAP_MKNOD, 避免容器创建宿主机磁盘等设备节点, 需要时通过 --cap-add 添加
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// capset(2) 参数
+type capUserHeader struct {
+	Version uint32
+	Pid     int32
+}
+
+type capUserData struct {
+	Effective   uint32
+	Permitted   uint32
+	Inheritable uint32
+}
+
+// DefaultCapabilities 容器默认的capability
+func DefaultCapabilities() []string {
+	return sortCapabilities(append([]string{}, defaultCapabilities...))
+}
+
+// AllCapabilities 所有已知的capability, 用于特权容器
+func AllCapabilities() []string {
+	caps := make([]string, 0, len(capabilityNumbers))
+	for name := range capabilityNumbers {
+		caps = append(caps, name)
+	}
+
+	return sortCapabilities(caps)
+}
+
+// ResolveCapabilities 在base的基础上先删除capDrop再添加capAdd, 名称不区分大小写, 可以省略 CAP_ 前缀
+// capDrop中包含ALL时从空集合开始, capAdd中包含ALL时添加所有capability
+func ResolveCapabilities(base, capAdd, capDrop []string) ([]string, error) {
+	capSet := make(map[string]bool)
+	for _, name := range base {
+		capSet[name] = true
+	}
+
+	for _, name := range capDrop {
+		name, err := normalizeCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == capabilityAll {
+			capSet = make(map[string]bool)
+			continue
+		}
+		delete(capSet, name)
+	}
+	for _, name := range capAdd {
+		name, err := normalizeCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == capabilityAll {
+			for all := range capabilityNumbers {
+				capSet[all] = true
+			}
+			continue
+		}
+		capSet[name] = true
+	}
+
+	caps := make([]string, 0, len(capSet))
+	for name := range capSet {
+		caps = append(caps, name)
+	}
+
+	return sortCapabilities(caps), nil
+}
+
+// 统一capability名称格式为 CAP_XXX
+func normalizeCapability(name string) (string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == capabilityAll {
+		return name, nil
+	}
+	if !strings.HasPrefix(name, capabilityPrefix) {
+		name = capabilityPrefix + name
+	}
+	if _, exist := capabilityNumbers[name]; !exist {
+		return "", fmt.Errorf("unknown capability %q", name)
+	}
+
+	return name, nil
+}
+
+// 按capability编号排序
+func sortCapabilities(caps []string) []string {
+	sort.Slice(caps, func(i, j int) bool {
+		return capabilityNumbers[caps[i]] < capabilityNumbers[caps[j]]
+	})
+
+	return caps
+}
+
+// 切换用户并将进程capability限制为caps, 非root用户不保留capability, 只限制bounding set
+// capability是线程属性, 调用后当前goroutine锁定在该线程上, 用户进程需由该线程exec或fork
+func setupUserCapabilities(user string, env []string, caps []string) ([]string, error) {
+	runtime.LockOSThread()
+
+	var capBits [2]uint32
+	for _, name := range caps {
+		number, exist := capabilityNumbers[name]
+		if !exist {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		capBits[number/32] |= 1 << (number % 32)
+	}
+
+	// 先收缩bounding set, 需要CAP_SETPCAP
+	for number := uint(0); number <= getLastCapability(); number++ {
+		if number < 64 && capBits[number/32]&(1<<(number%32)) != 0 {
+			continue
+		}
+		if err := prctl(syscall.PR_CAPBSET_DROP, uintptr(number)); err != nil && err != syscall.EINVAL {
+			return nil, fmt.Errorf("drop capability %d from bounding set error, %v", number, err)
+		}
+	}
+
+	// 切换用户时保留permitted capability, 切换完成后再设置为最终的capability
+	if err := prctl(syscall.PR_SET_KEEPCAPS, 1); err != nil {
+		return nil, fmt.Errorf("set keep caps error, %v", err)
+	}
+	env, err := setupUser(user, env)
+	if err != nil {
+		return nil, err
+	}
+	if err = prctl(syscall.PR_SET_KEEPCAPS, 0); err != nil {
+		return nil, fmt.Errorf("clear keep caps error, %v", err)
+	}
+
+	// 只能保留当前进程已拥有的capability, 如宿主机上的mdocker本身受限时
+	header := capUserHeader{Version: linuxCapabilityVersion3}
+	var data [2]capUserData
+	_, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("capget error, %v", errno)
+	}
+	for i := range data {
+		if syscall.Getuid() != 0 {
+			capBits[i] = 0
+		}
+		capBits[i] &= data[i].Permitted
+		data[i] = capUserData{Effective: capBits[i], Permitted: capBits[i]}
+	}
+	_, _, errno = syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("capset error, %v", errno)
+	}
+
+	return env, nil
+}
+
+// 读取内核支持的最大capability编号, 读取失败时使用已知的最大编号
+func getLastCapability() uint {
+	lastCap := capabilityNumbers["CAP_CHECKPOINT_RESTORE"]
+	content, err := ioutil.ReadFile(capLastCapPath)
+	if err != nil {
+		return lastCap
+	}
+	if number, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+		lastCap = uint(number)
+	}
+
+	return lastCap
+}
+
+func prctl(option int, arg uintptr) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, uintptr(option), arg, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package container_init
+
+import (
+	"bufio"
+	"docker/config"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// CgroupMounts 生成容器内 /sys/fs/cgroup 的挂载点, 目录结构与宿主机一致, 使容器内的进程可以读取自身的资源限制
+// 使用独立的cgroup namespace时挂载各cgroup层级, 挂载的根目录即为容器的cgroup
+// 否则将init进程所在的cgroup目录bind挂载到对应层级, 需要在init进程加入容器cgroup之后调用
+func CgroupMounts(pid int, privateNs, readonly bool) ([]Mount, error) {
+	cgroupMounts, err := readCgroupMountInfo()
+	if err != nil {
+		return nil, err
+	}
+	if len(cgroupMounts) == 0 {
+		return nil, nil
+	}
+	processCgroups, err := readProcessCgroups(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	remountFlags := flags | syscall.MS_REMOUNT | syscall.MS_RDONLY
+	var mounts []Mount
+	// cgroup v1的各层级挂载在 /sys/fs/cgroup 下的tmpfs中
+	hasTmpfs := cgroupMounts[0].mountPoint != cgroupMountPath
+	if hasTmpfs {
+		mounts = append(mounts, Mount{
+			Source:      "tmpfs",
+			Destination: cgroupMountPath,
+			Type:        "tmpfs",
+			Flags:       flags,
+			Data:        "mode=755",
+		})
+	}
+	for _, cgroupMount := range cgroupMounts {
+		if privateNs {
+			mount := Mount{
+				Source:      cgroupMount.fsType,
+				Destination: cgroupMount.mountPoint,
+				Type:        cgroupMount.fsType,
+				Flags:       flags,
+				Data:        strings.Join(cgroupMount.options, ","),
+			}
+			if readonly {
+				mount.Flags |= syscall.MS_RDONLY
+			}
+			mounts = append(mounts, mount)
+			continue
+		}
+
+		cgroupPath, exist := processCgroups[cgroupMount.hierarchyKey()]
+		if !exist || !strings.HasPrefix(cgroupPath, cgroupMount.root) {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Source:      path.Join(cgroupMount.mountPoint, strings.TrimPrefix(cgroupPath, cgroupMount.root)),
+			Destination: cgroupMount.mountPoint,
+			Type:        "bind",
+			Flags:       flags | syscall.MS_BIND | syscall.MS_REC,
+		})
+		// bind挂载需要重新挂载才能设置为只读
+		if readonly {
+			mounts = append(mounts, Mount{Destination: cgroupMount.mountPoint, Flags: remountFlags | syscall.MS_BIND})
+		}
+	}
+	if readonly && hasTmpfs {
+		mounts = append(mounts, Mount{
+			Source:      "tmpfs",
+			Destination: cgroupMountPath,
+			Type:        "tmpfs",
+			Flags:       remountFlags,
+			Data:        "mode=755",
+		})
+	}
+
+	return mounts, nil
+}
+
+// 宿主机上的cgroup挂载点
+type cgroupMountInfo struct {
+	mountPoint string
+	root       string   // 挂载的cgroup目录
+	fsType     string   // cgroup 或 cgroup2
+	options    []string // 挂载参数, cgroup v1为层级包含的subsystem, 如 cpu,cpuacct 或 name=systemd
+}
+
+// 获取cgroup层级在 /proc/{pid}/cgroup 中的标识, cgroup v2为空字符串
+func (m *cgroupMountInfo) hierarchyKey() string {
+	if m.fsType == cgroupV2FsType {
+		return ""
+	}
+
+	var subsystems []string
+	for _, option := range m.options {
+		if option == "none" || option == "xattr" || option == "noprefix" || strings.HasPrefix(option, "release_agent=") ||
+			strings.HasPrefix(option, "clone_children") || option == "cpuset_v2_mode" {
+			continue
+		}
+		subsystems = append(subsystems, option)
+	}
+
+	return strings.Join(subsystems, ",")
+}
+
+// 读取宿主机 /sys/fs/cgroup 下的cgroup挂载点, 按挂载路径排序, 确保父目录在前
+func readCgroupMountInfo() ([]*cgroupMountInfo, error) {
+	file, err := os.Open(config.ProcessMountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("open mountinfo error, %v", err)
+	}
+	defer file.Close()
+
+	var cgroupMounts []*cgroupMountInfo
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 格式: id parent major:minor root mount-point options [optional...] - fstype source super-options
+		fields := strings.Fields(scanner.Text())
+		sepIdx := -1
+		for i, field := range fields {
+			if field == "-" {
+				sepIdx = i
+				break
+			}
+		}
+		if sepIdx < 5 || len(fields) < sepIdx+4 {
+			continue
+		}
+		fsType, mountPoint := fields[sepIdx+1], fields[4]
+		if fsType != cgroupV1FsType && fsType != cgroupV2FsType {
+			continue
+		}
+		if mountPoint != cgroupMountPath && !strings.HasPrefix(mountPoint, cgroupMountPath+"/") {
+			continue
+		}
+
+		var options []string
+		for _, option := range strings.Split(fields[sepIdx+3], ",") {
+			if option != "rw" && option != "ro" {
+				options = append(options, option)
+			}
+		}
+		cgroupMounts = append(cgroupMounts, &cgroupMountInfo{
+			mountPoint: mountPoint,
+			root:       fields[3],
+			fsType:     fsType,
+			options:    options,
+		})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read mountinfo error, %v", err)
+	}
+
+	sort.Slice(cgroupMounts, func(i, j int) bool {
+		return cgroupMounts[i].mountPoint < cgroupMounts[j].mountPoint
+	})
+
+	return cgroupMounts, nil
+}
+
+// 读取进程所在的cgroup, 返回 层级标识 -> cgroup路径
+func readProcessCgroups(pid int) (map[string]string, error) {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, fmt.Errorf("read process cgroup error, %v", err)
+	}
+
+	cgroups := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		// 格式: hierarchy-id:subsystems:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) == 3 {
+			cgroups[parts[1]] = parts[2]
+		}
+	}
+
+	return cgroups, nil
+}
@@ -0,0 +1,185 @@
+package container_init
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// 终端窗口大小, 与内核 struct winsize 一致
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// region 宿主机侧
+
+// NewConsoleSocket 创建传递伪终端master的socket对, 第二个返回值需作为 ExtraFiles[1] 传递给容器进程
+func NewConsoleSocket() (*os.File, *os.File, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("console socket create error, %v", err)
+	}
+
+	return os.NewFile(uintptr(fds[0]), "console-socket"), os.NewFile(uintptr(fds[1]), "console-socket"), nil
+}
+
+// ReceiveConsole 接收容器进程创建的伪终端master, 容器进程未发送就退出时返回错误
+func ReceiveConsole(consoleSocket *os.File) (*os.File, error) {
+	defer consoleSocket.Close()
+
+	buf := make([]byte, 64)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(int(consoleSocket.Fd()), buf, oob, 0)
+	if err != nil {
+		return nil, fmt.Errorf("console receive error, %v", err)
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(messages) != 1 {
+		return nil, fmt.Errorf("console receive error, container process exited before sending console")
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	if err != nil || len(fds) != 1 {
+		return nil, fmt.Errorf("console receive error, invalid console fd")
+	}
+
+	return os.NewFile(uintptr(fds[0]), "console"), nil
+}
+
+// AttachConsole 将宿主机终端设置为raw模式, 在宿主机标准输入输出与伪终端之间转发数据, 并同步窗口大小
+// 返回的函数等待容器输出转发完成后恢复宿主机终端, 需在容器进程退出后调用
+func AttachConsole(console *os.File) func() {
+	stdinFd := os.Stdin.Fd()
+	var restore func()
+	if isTerminal(stdinFd) {
+		restore = setRawMode(stdinFd)
+		resizeConsole(console, stdinFd)
+
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		go func() {
+			for range winch {
+				resizeConsole(console, stdinFd)
+			}
+		}()
+	}
+
+	go func() {
+		_, _ = io.Copy(console, os.Stdin)
+	}()
+	outputDone := make(chan struct{})
+	go func() {
+		// 伪终端slave全部关闭后读取返回EIO
+		_, _ = io.Copy(os.Stdout, console)
+		close(outputDone)
+	}()
+
+	return func() {
+		<-outputDone
+		_ = console.Close()
+		if restore != nil {
+			restore()
+		}
+	}
+}
+
+// 将终端设置为raw模式, 与cfmakeraw(3)一致, 返回恢复原终端设置的函数
+func setRawMode(fd uintptr) func() {
+	var oldState syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&oldState))); err != nil {
+		return nil
+	}
+
+	newState := oldState
+	newState.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	newState.Oflag &^= syscall.OPOST
+	newState.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	newState.Cflag &^= syscall.CSIZE | syscall.PARENB
+	newState.Cflag |= syscall.CS8
+	newState.Cc[syscall.VMIN] = 1
+	newState.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&newState))); err != nil {
+		return nil
+	}
+
+	return func() {
+		_ = ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&oldState)))
+	}
+}
+
+// 将宿主机终端的窗口大小同步到伪终端
+func resizeConsole(console *os.File, fd uintptr) {
+	var size winsize
+	if err := ioctl(fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size))); err != nil {
+		return
+	}
+	_ = ioctl(console.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size)))
+}
+
+// endregion
+
+// region 容器侧
+
+// 使用容器devpts创建伪终端, 将master通过console socket发送给宿主机
+// slave作为当前进程的标准输入输出和控制终端, 需要在挂载 /dev/pts 之后调用
+func setupConsole() error {
+	consoleSocket := os.NewFile(uintptr(consoleSocketFd), "console-socket")
+	defer consoleSocket.Close()
+
+	// 创建新会话以脱离宿主机终端, 之后才能设置新的控制终端
+	if _, err := syscall.Setsid(); err != nil {
+		return fmt.Errorf("setsid error, %v", err)
+	}
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open ptmx error, %v", err)
+	}
+	defer master.Close()
+	unlock := 0
+	if err = ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return fmt.Errorf("unlockpt error, %v", err)
+	}
+	var ptyNumber uint32
+	if err = ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptyNumber))); err != nil {
+		return fmt.Errorf("ptsname error, %v", err)
+	}
+	slavePath := fmt.Sprintf("/dev/pts/%d", ptyNumber)
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return fmt.Errorf("open %s error, %v", slavePath, err)
+	}
+	defer slave.Close()
+
+	rights := syscall.UnixRights(int(master.Fd()))
+	if err = syscall.Sendmsg(int(consoleSocket.Fd()), []byte(slavePath), rights, nil, 0); err != nil {
+		return fmt.Errorf("console send error, %v", err)
+	}
+
+	for fd := 0; fd < 3; fd++ {
+		if err = syscall.Dup3(int(slave.Fd()), fd, 0); err != nil {
+			return fmt.Errorf("dup console to fd %d error, %v", fd, err)
+		}
+	}
+	if err = ioctl(0, syscall.TIOCSCTTY, 0); err != nil {
+		return fmt.Errorf("set controlling terminal error, %v", err)
+	}
+
+	return nil
+}
+
+// endregion
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
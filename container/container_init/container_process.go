@@ -3,9 +3,9 @@ package container_init
 import (
 	"docker/config"
 	"docker/container/container_info"
+	"docker/container/seccomp"
 	"docker/utils"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
@@ -14,8 +14,10 @@ import (
 
 // NewContainerProcess 重新创建容器父进程:
 // 			1. 创建Namespace
-//			2. 创建一个fifo管道, 将管道的读取端fd设置给新创建的init进程, 返回读取端fd供写入参数
-func NewContainerProcess(tty bool, volume, containerName, imageName string) (*exec.Cmd, *os.File, error) {
+//			2. 创建一个fifo管道, 将管道的读取端fd设置给新创建的init进程, 返回写入端供写入init配置
+//			3. init进程不继承宿主机的环境变量, 用户进程的环境变量由init配置指定
+//			4. 指定idMappings时创建user namespace, 容器root映射为宿主机上的普通用户, rootless模式下映射为当前用户
+func NewContainerProcess(tty bool, volume, containerName string, imageLayers []string, idMappings *IdMappings) (*exec.Cmd, *os.File, error) {
 	// 尝试创建获取一个pipe
 	readPipe, writePipe, err := newPipe()
 	if err != nil {
@@ -26,6 +28,18 @@ func NewContainerProcess(tty bool, volume, containerName, imageName string) (*ex
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags: config.ProcessCloneFlags,
 	}
+	cmd.Env = []string{}
+	if config.Rootless {
+		idMappings = rootlessIdMappings()
+	}
+	if idMappings != nil {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = idMappings.UidMaps
+		cmd.SysProcAttr.GidMappings = idMappings.GidMaps
+		// 容器内的用户切换需要调用setgroups, 非root用户写入gid映射前必须禁用setgroups
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = !config.Rootless
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: config.Rootless}
+	}
 
 	// 处理init进程的io
 	if err = procInitProcessIO(cmd, tty, containerName); err != nil {
@@ -36,7 +50,7 @@ func NewContainerProcess(tty bool, volume, containerName, imageName string) (*ex
 	cmd.ExtraFiles = []*os.File{readPipe}
 
 	// 在指定挂载点上创建容器的文件视图
-	mntPath, err := newWorkSpace(containerName, imageName, volume)
+	mntPath, err := newWorkSpace(containerName, imageLayers, volume, idMappings)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -61,7 +75,7 @@ func procInitProcessIO(cmd *exec.Cmd, tty bool, containerName string) error {
 	}
 
 	containerInfoPath := container_info.GetContainerInfoDirPath(containerName)
-	if err := os.MkdirAll(containerInfoPath, 0622); err != nil {
+	if err := os.MkdirAll(containerInfoPath, 0755); err != nil {
 		return fmt.Errorf("NewParentProcess mkdir %s error %v", containerInfoPath, err)
 	}
 	stdLogFilePath := container_info.GetContainerLogFilePath(containerName)
@@ -79,39 +93,102 @@ func ContainerProcessInit() error {
 	utils.LoggerUtil.Infof("container init start")
 
 	// process will stuck here waiting for the reading the pipe
-	cmdArray := readUserCommand()
-	if cmdArray == nil || len(cmdArray) == 0 {
-		return fmt.Errorf("container init command read nil")
+	initConf, err := readInitConfig()
+	if err != nil {
+		return err
 	}
 
-	// 初始化容器mount
-	if err := mountInit(); err != nil {
+	// 初始化容器mount和设备节点
+	if err = mountInit(initConf.Rootfs, initConf.Mounts, initConf.Devices); err != nil {
 		return fmt.Errorf("mount init failed: %v", err)
 	}
 
+	// 屏蔽/proc和/sys下的敏感路径
+	if err = maskPaths(initConf.MaskedPaths); err != nil {
+		return err
+	}
+	if err = readonlyPaths(initConf.ReadonlyPaths); err != nil {
+		return err
+	}
+	if initConf.Terminal {
+		if err = setupConsole(); err != nil {
+			return fmt.Errorf("console init failed: %v", err)
+		}
+	}
+
+	if initConf.Hostname != "" {
+		if err = syscall.Sethostname([]byte(initConf.Hostname)); err != nil {
+			return fmt.Errorf("set hostname error, %v", err)
+		}
+	}
+
+	// 切换到镜像指定的工作目录
+	if err = setupWorkDir(initConf.Cwd); err != nil {
+		return err
+	}
+
+	// 挂载点和工作目录创建完成后, 将根文件系统设置为只读
+	if initConf.Readonly {
+		if err = remountRootReadonly(); err != nil {
+			return err
+		}
+	}
+
+	// 安装seccomp过滤器, 需要在放弃CAP_SYS_ADMIN之前安装
+	if err = seccomp.InitSeccomp(initConf.Seccomp, initConf.Capabilities); err != nil {
+		return err
+	}
+
+	// 切换为指定的用户并限制capability, 用户名按容器rootfs中的 /etc/passwd 解析
+	if initConf.Env, err = setupUserCapabilities(initConf.User, initConf.Env, initConf.Capabilities); err != nil {
+		return err
+	}
+
+	// 使用init配置中的环境变量替换当前环境变量, 以便按容器的PATH查找命令
+	setupEnv(initConf.Env)
+
 	// look up for the absolute path of cmd in the current PATH env var
-	cmdPath, err := exec.LookPath(cmdArray[0])
+	cmdPath, err := exec.LookPath(initConf.Args[0])
 	if err != nil {
 		return err
 	}
 
-	// call exec to replace current process, cmdArray: exec file path(only used for display), params...
-	if err = syscall.Exec(cmdPath, cmdArray[0:], os.Environ()); err != nil {
-		utils.LoggerUtil.Fatalf("mount fail: %s", err.Error())
+	// init模式下当前进程保留为1号进程, 用户进程作为子进程运行
+	if initConf.Init {
+		return runInitProcess(cmdPath, initConf.Args, initConf.Env)
+	}
+
+	// call exec to replace current process, args: exec file path(only used for display), params...
+	if err = syscall.Exec(cmdPath, initConf.Args, initConf.Env); err != nil {
+		utils.LoggerUtil.Fatalf("exec fail: %s", err.Error())
 	}
 
 	return nil
 }
 
-func readUserCommand() []string {
-	// open the 4th fd of the process
-	readPipe := os.NewFile(uintptr(3), "pipe")
-	msg, err := ioutil.ReadAll(readPipe)
-	if err != nil {
-		utils.LoggerUtil.Errorf("init read pipe error: %v", err)
+// 清空当前环境变量并设置为指定的环境变量
+func setupEnv(env []string) {
+	os.Clearenv()
+	for _, item := range env {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 2 {
+			_ = os.Setenv(kv[0], kv[1])
+		}
+	}
+}
 
+// 切换init进程的工作目录, 目录不存在时自动创建
+func setupWorkDir(workDir string) error {
+	if workDir == "" {
 		return nil
 	}
 
-	return strings.Split(string(msg), " ")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("work dir %s create error, %v", workDir, err)
+	}
+	if err := syscall.Chdir(workDir); err != nil {
+		return fmt.Errorf("chdir %s error, %v", workDir, err)
+	}
+
+	return nil
 }
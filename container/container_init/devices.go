@@ -0,0 +1,154 @@
+package container_init
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// 容器 /dev 下的标准链接, 与docker保持一致
+var devSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// 容器默认创建的设备节点
+func defaultDevices() []Device {
+	newCharDevice := func(devPath string, major, minor uint32) Device {
+		return Device{Path: devPath, Type: DeviceTypeChar, Major: major, Minor: minor, FileMode: 0666}
+	}
+
+	return []Device{
+		newCharDevice("/dev/null", 1, 3),
+		newCharDevice("/dev/zero", 1, 5),
+		newCharDevice("/dev/full", 1, 7),
+		newCharDevice("/dev/random", 1, 8),
+		newCharDevice("/dev/urandom", 1, 9),
+		newCharDevice("/dev/tty", 5, 0),
+	}
+}
+
+// ParseDevice 解析 --device 参数, 格式为 host-path[:container-path], 按宿主机设备的类型和设备号生成设备节点
+func ParseDevice(deviceSpec string) (*Device, error) {
+	hostPath, containerPath := deviceSpec, deviceSpec
+	if idx := strings.Index(deviceSpec, ":"); idx >= 0 {
+		hostPath, containerPath = deviceSpec[:idx], deviceSpec[idx+1:]
+	}
+	if !filepath.IsAbs(hostPath) || !filepath.IsAbs(containerPath) {
+		return nil, fmt.Errorf("invalid device %q, format: host-path[:container-path]", deviceSpec)
+	}
+
+	info, err := os.Stat(hostPath)
+	if err != nil {
+		return nil, fmt.Errorf("device %s stat error, %v", hostPath, err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || info.Mode()&os.ModeDevice == 0 {
+		return nil, fmt.Errorf("%s is not a device", hostPath)
+	}
+
+	device := &Device{
+		Path:     filepath.Clean(containerPath),
+		Type:     DeviceTypeBlock,
+		Major:    uint32((stat.Rdev>>8)&0xfff | (stat.Rdev>>32)&^0xfff),
+		Minor:    uint32(stat.Rdev&0xff | (stat.Rdev>>12)&^0xff),
+		FileMode: info.Mode().Perm(),
+		Uid:      stat.Uid,
+		Gid:      stat.Gid,
+		HostPath: filepath.Clean(hostPath),
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		device.Type = DeviceTypeChar
+	}
+
+	return device, nil
+}
+
+// 在rootfs下创建设备节点和 /dev 下的标准链接, 需要在挂载 /dev 之后, 切换rootfs之前调用
+func setupDevices(root string, devices []Device) error {
+	// 设备节点的权限由配置指定, 不受umask影响
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+
+	for _, device := range devices {
+		if err := createDevice(root, device); err != nil {
+			return err
+		}
+	}
+
+	for _, link := range devSymlinks {
+		linkPath, err := resolveTargetInRoot(root, link[1])
+		if err != nil {
+			return fmt.Errorf("resolve %s error, %v", link[1], err)
+		}
+		if err = os.Symlink(link[0], linkPath); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("symlink %s error, %v", link[1], err)
+		}
+	}
+
+	return nil
+}
+
+// 创建单个设备节点, 已存在的同名文件会被替换
+// user namespace中没有创建设备节点的权限, mknod失败时改为bind挂载宿主机上的设备
+func createDevice(root string, device Device) error {
+	mode := uint32(device.FileMode.Perm())
+	switch device.Type {
+	case DeviceTypeChar:
+		mode |= syscall.S_IFCHR
+	case DeviceTypeBlock:
+		mode |= syscall.S_IFBLK
+	default:
+		return fmt.Errorf("device %s has invalid type %q", device.Path, device.Type)
+	}
+
+	// 设备路径按rootfs解析符号链接, 避免镜像通过符号链接在宿主机上创建设备节点
+	devicePath, err := resolveTargetInRoot(root, device.Path)
+	if err != nil {
+		return fmt.Errorf("resolve %s error, %v", device.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(devicePath), 0755); err != nil {
+		return fmt.Errorf("mkdir %s error, %v", filepath.Dir(device.Path), err)
+	}
+	if err := os.Remove(devicePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s error, %v", device.Path, err)
+	}
+
+	dev := int(device.Major&0xfff)<<8 | int(device.Minor&0xff) |
+		int(device.Major&^0xfff)<<32 | int(device.Minor&^0xff)<<12
+	if err := syscall.Mknod(devicePath, mode, dev); err != nil {
+		if err == syscall.EPERM {
+			return bindDevice(devicePath, device)
+		}
+		return fmt.Errorf("mknod %s error, %v", device.Path, err)
+	}
+	if err := os.Chown(devicePath, int(device.Uid), int(device.Gid)); err != nil {
+		return fmt.Errorf("chown %s error, %v", device.Path, err)
+	}
+
+	return nil
+}
+
+// 将宿主机设备bind挂载到容器内的设备路径
+func bindDevice(devicePath string, device Device) error {
+	hostPath := device.HostPath
+	if hostPath == "" {
+		hostPath = device.Path
+	}
+
+	file, err := os.OpenFile(devicePath, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("create %s error, %v", device.Path, err)
+	}
+	_ = file.Close()
+	if err = syscall.Mount(hostPath, devicePath, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind device %s error, %v", hostPath, err)
+	}
+
+	return nil
+}
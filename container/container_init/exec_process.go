@@ -0,0 +1,44 @@
+package container_init
+
+import (
+	"docker/container/seccomp"
+	"os/exec"
+	"syscall"
+)
+
+// ExecProcessInit 在容器中执行命令, 进程启动前已由nsenter加入容器的namespace
+// 切换到指定用户后直接替换为用户命令, nsenter的父进程负责等待并返回命令的退出码
+func ExecProcessInit() error {
+	execConf, err := readInitConfig()
+	if err != nil {
+		return err
+	}
+
+	// 加入mnt namespace后当前目录仍指向宿主机, 默认切换到容器根目录
+	if execConf.Cwd == "" {
+		execConf.Cwd = "/"
+	}
+	if err = syscall.Chdir(execConf.Cwd); err != nil {
+		return err
+	}
+	if execConf.Terminal {
+		if err = setupConsole(); err != nil {
+			return err
+		}
+	}
+	if err = seccomp.InitSeccomp(execConf.Seccomp, execConf.Capabilities); err != nil {
+		return err
+	}
+	if execConf.Env, err = setupUserCapabilities(execConf.User, execConf.Env, execConf.Capabilities); err != nil {
+		return err
+	}
+
+	// 按容器的PATH查找命令
+	setupEnv(execConf.Env)
+	cmdPath, err := exec.LookPath(execConf.Args[0])
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(cmdPath, execConf.Args, execConf.Env)
+}
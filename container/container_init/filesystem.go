@@ -2,35 +2,60 @@ package container_init
 
 import (
 	"docker/config"
-	"docker/utils"
+	"docker/container/image"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
+	"syscall"
 )
 
 // region 容器初始化, 创建文件系统
 
-// 创建容器的工作目录
-func newWorkSpace(containerName, imageName, volume string) (string, error) {
-	// 判断镜像是否存在
-	imagePath := getImagePath(imageName)
-	imageExists, err := utils.GeneralUtils.IsDirExists(imagePath)
+// 创建容器的工作目录, 指定idMappings时使用修改属主后的镜像层, 读写层属于映射后的容器root
+func newWorkSpace(containerName string, imageLayers []string, volume string, idMappings *IdMappings) (string, error) {
+	// 获取镜像的各层目录
+	var lowerDirs []string
+	var err error
+	if idMappings == nil {
+		lowerDirs, err = image.GetLayerLowerDirs(imageLayers)
+	} else {
+		lowerDirs, err = image.GetRemappedLayerLowerDirs(imageLayers, idMappings.UidMaps, idMappings.GidMaps)
+	}
 	if err != nil {
-		return "", fmt.Errorf("image path existence judge fail, %v", err)
+		return "", err
 	}
-	if imageExists == false {
-		return "", fmt.Errorf("image not exists")
+
+	// 首次运行时创建容器文件系统的存储目录
+	for _, dirPath := range []string{config.PathReadWrite, config.PathWorkDir, config.PathMnt} {
+		if err = os.MkdirAll(dirPath, 0755); err != nil {
+			return "", fmt.Errorf("mkdir dir %s error. %v", dirPath, err)
+		}
 	}
 
 	// 创建aufs读写层branch
 	if err = createOverlay2Layers(containerName); err != nil {
 		return "", err
 	}
+	if idMappings != nil {
+		if err = chownRemappedRoot(getRwLayerPath(containerName), idMappings); err != nil {
+			return "", err
+		}
+	}
+
+	// rootless模式下没有挂载权限, rootfs和volume由init进程在容器的mount namespace中挂载
+	if config.Rootless {
+		// 挂载前的目录只有当前用户可以访问, 避免其他用户在其中创建文件
+		mntPath := getMntPointPath(containerName)
+		if err = os.Mkdir(mntPath, 0700); err != nil {
+			return "", fmt.Errorf("mkdir dir %s error. %v", mntPath, err)
+		}
+		return mntPath, nil
+	}
 
 	// aufs联合挂载
-	mntPath, err := createMountPoint(containerName, imagePath)
+	mntPath, err := createMountPoint(containerName, lowerDirs)
 	if err != nil {
 		return "", err
 	}
@@ -54,14 +79,31 @@ func createOverlay2Layers(containerName string) error {
 	// workdir
 	workPath := getWorkDirPath(containerName)
 	if err := os.Mkdir(workPath, 0777); err != nil {
-		return fmt.Errorf("mkdir dir %s error: $v", workPath, err)
+		return fmt.Errorf("mkdir dir %s error: %v", workPath, err)
+	}
+
+	return nil
+}
+
+// 将目录的属主修改为映射后的容器root
+func chownRemappedRoot(dirPath string, idMappings *IdMappings) error {
+	rootUid, err := image.MapIdToHost(0, idMappings.UidMaps)
+	if err != nil {
+		return err
+	}
+	rootGid, err := image.MapIdToHost(0, idMappings.GidMaps)
+	if err != nil {
+		return err
+	}
+	if err = os.Chown(dirPath, rootUid, rootGid); err != nil {
+		return fmt.Errorf("chown %s error, %v", dirPath, err)
 	}
 
 	return nil
 }
 
 // 使用aufs挂载容器文件视图
-func createMountPoint(containerName, imagePath string) (string, error) {
+func createMountPoint(containerName string, lowerDirs []string) (string, error) {
 	// 创建挂载点
 	mntPath := getMntPointPath(containerName)
 	if err := os.Mkdir(mntPath, 0777); err != nil {
@@ -69,7 +111,7 @@ func createMountPoint(containerName, imagePath string) (string, error) {
 	}
 
 	// 挂载unionFs
-	dirs := getContainerMountParam(containerName, imagePath)
+	dirs := getContainerMountParam(containerName, lowerDirs)
 	cmd := exec.Command("mount", "-t", "overlay", "overlay", "-o", dirs, mntPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -80,6 +122,43 @@ func createMountPoint(containerName, imagePath string) (string, error) {
 	return mntPath, nil
 }
 
+// SetRootlessRootfs rootless模式下设置由init进程挂载的rootfs, 并将用户volume转换为bind挂载
+// 非rootless模式下rootfs和volume已由宿主机挂载, 不做处理
+func (initConf *InitConfig) SetRootlessRootfs(containerName string, imageLayers []string, volume string) error {
+	if !config.Rootless {
+		return nil
+	}
+
+	lowerDirs, err := image.GetLayerLowerDirs(imageLayers)
+	if err != nil {
+		return err
+	}
+	initConf.Rootfs = &Mount{
+		Source: "overlay",
+		Type:   "overlay",
+		Data:   getContainerMountParam(containerName, lowerDirs) + "," + overlayRootlessOption,
+	}
+
+	if volume == "" {
+		return nil
+	}
+	volumeUrls := strings.Split(volume, ":")
+	if len(volumeUrls) != 2 || volumeUrls[0] == "" || volumeUrls[1] == "" {
+		return fmt.Errorf("invalid volume params: %v", volumeUrls)
+	}
+	if err = os.MkdirAll(volumeUrls[0], 0755); err != nil {
+		return fmt.Errorf("host path create fail: %v", err)
+	}
+	initConf.Mounts = append(initConf.Mounts, Mount{
+		Source:      volumeUrls[0],
+		Destination: volumeUrls[1],
+		Type:        "bind",
+		Flags:       syscall.MS_BIND | syscall.MS_REC,
+	})
+
+	return nil
+}
+
 // 处理用户volume挂载
 func handleUserVolume(mntPath, volume string) error {
 	if volume == "" {
@@ -127,14 +206,17 @@ func doMountVolumeOpr(mntPath string, volumeUrls []string) error {
 func DeleteWorkSpace(containerName, volume string) error {
 	// 清楚用户挂载volume
 	mntPath := getMntPointPath(containerName)
-	// 需要先取消用户挂载目录, 再取消根目录挂载
-	if err := deleteUserVolume(mntPath, volume); err != nil {
-		return err
-	}
+	// rootless模式下的挂载位于容器的mount namespace中, 随容器退出自动卸载
+	if !config.Rootless {
+		// 需要先取消用户挂载目录, 再取消根目录挂载
+		if err := deleteUserVolume(mntPath, volume); err != nil {
+			return err
+		}
 
-	// 取消容器文件系统挂载
-	if err := deleteMountPoint(mntPath); err != nil {
-		return err
+		// 取消容器文件系统挂载
+		if err := deleteMountPoint(mntPath); err != nil {
+			return err
+		}
 	}
 
 	// 删除相关挂载目录
@@ -194,9 +276,9 @@ func rmDirAll(rwLayerPath string) error {
 
 // region 路径获取方法
 
-// 获取指定镜像路径
-func getImagePath(imageName string) string {
-	return path.Join(config.PathImage, imageName)
+// GetContainerRwLayerPath 获取容器的overlay upperdir, 即容器对镜像的修改内容
+func GetContainerRwLayerPath(containerName string) string {
+	return getRwLayerPath(containerName)
 }
 
 // 获取container rw layer路径
@@ -214,12 +296,12 @@ func getMntPointPath(containerIdent string) string {
 	return path.Join(config.PathMnt, containerIdent)
 }
 
-// 获取容器挂载参数
-func getContainerMountParam(containerName, imagePath string) string {
+// 获取容器挂载参数, lowerDirs需由最顶层到最底层排列
+func getContainerMountParam(containerName string, lowerDirs []string) string {
 	rwPath := getRwLayerPath(containerName)
 	workDirPath := getWorkDirPath(containerName)
 
-	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", imagePath, rwPath, workDirPath)
+	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(lowerDirs, ":"), rwPath, workDirPath)
 }
 
 // endregion
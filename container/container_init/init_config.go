@@ -0,0 +1,174 @@
+package container_init
+
+import (
+	"docker/config"
+	"docker/container/image"
+	"docker/container/seccomp"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// NewInitConfig 根据用户进程argv和镜像config生成init配置
+// 环境变量使用镜像定义的环境变量, 未定义PATH时使用默认PATH
+func NewInitConfig(args []string, containerConf *image.ContainerConfig, hostname string) *InitConfig {
+	env := append([]string{}, containerConf.Env...)
+	hasPath := false
+	for _, item := range env {
+		if strings.HasPrefix(item, "PATH=") {
+			hasPath = true
+			break
+		}
+	}
+	if !hasPath {
+		env = append(env, config.DefaultPathEnv)
+	}
+
+	return &InitConfig{
+		Version:  InitConfigVersion,
+		Args:     args,
+		Env:      env,
+		Cwd:      containerConf.WorkingDir,
+		User:     containerConf.User,
+		Hostname: hostname,
+		Mounts:   defaultMounts(),
+		Devices:  defaultDevices(),
+
+		MaskedPaths:   defaultMaskedPaths,
+		ReadonlyPaths: defaultReadonlyPaths,
+		Capabilities:  DefaultCapabilities(),
+		Seccomp:       seccomp.DefaultProfile(),
+	}
+}
+
+// SetPrivileged 特权模式, 保留所有capability, 不过滤系统调用, 不屏蔽/proc和/sys下的敏感路径, sysfs以读写方式挂载
+func (initConf *InitConfig) SetPrivileged() {
+	initConf.Capabilities = AllCapabilities()
+	initConf.Seccomp = nil
+	initConf.MaskedPaths = nil
+	initConf.ReadonlyPaths = nil
+	for i := range initConf.Mounts {
+		if initConf.Mounts[i].Type == "sysfs" {
+			initConf.Mounts[i].Flags &^= syscall.MS_RDONLY
+		}
+	}
+}
+
+var (
+	// 容器默认屏蔽的路径, 与docker保持一致
+	defaultMaskedPaths = []string{
+		"/proc/asound",
+		"/proc/acpi",
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+		"/proc/sched_debug",
+		"/proc/scsi",
+		"/sys/firmware",
+		"/sys/devices/virtual/powercap",
+	}
+
+	// 容器默认只读的路径
+	defaultReadonlyPaths = []string{
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+)
+
+// SendInitConfig 将init配置写入pipe, 写入完成后关闭pipe, init进程读取到EOF后开始初始化
+func SendInitConfig(initConf *InitConfig, initPipe *os.File) error {
+	defer initPipe.Close()
+
+	content, err := json.Marshal(initConf)
+	if err != nil {
+		return fmt.Errorf("init config marshal error, %v", err)
+	}
+	if _, err = initPipe.Write(content); err != nil {
+		return fmt.Errorf("init config write error, %v", err)
+	}
+
+	return nil
+}
+
+// 从pipe中读取init配置, 进程会阻塞直到父进程写入配置并关闭pipe
+func readInitConfig() (*InitConfig, error) {
+	readPipe := os.NewFile(uintptr(initPipeFd), "pipe")
+	defer readPipe.Close()
+
+	content, err := ioutil.ReadAll(readPipe)
+	if err != nil {
+		return nil, fmt.Errorf("init read pipe error, %v", err)
+	}
+
+	initConf := &InitConfig{}
+	if err = json.Unmarshal(content, initConf); err != nil {
+		return nil, fmt.Errorf("init config unmarshal error, %v", err)
+	}
+	if initConf.Version != InitConfigVersion {
+		return nil, fmt.Errorf("unsupported init config version %d", initConf.Version)
+	}
+	if len(initConf.Args) == 0 {
+		return nil, fmt.Errorf("init config missing args")
+	}
+
+	return initConf, nil
+}
+
+// 容器默认挂载的文件系统
+func defaultMounts() []Mount {
+	// rootless模式下容器内只映射了root, 不存在tty用户组
+	devptsData := "newinstance,ptmxmode=0666,mode=0620,gid=5"
+	if config.Rootless {
+		devptsData = "newinstance,ptmxmode=0666,mode=0620"
+	}
+
+	return []Mount{
+		{
+			Source:      "proc",
+			Destination: "/proc",
+			Type:        "proc",
+			Flags:       config.MountFlagsDefault,
+		},
+		{
+			Source:      "sysfs",
+			Destination: "/sys",
+			Type:        "sysfs",
+			Flags:       syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
+		},
+		{
+			Source:      "tmpfs",
+			Destination: "/dev",
+			Type:        "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_STRICTATIME,
+			Data:        "mode=755",
+		},
+		{
+			Source:      "devpts",
+			Destination: "/dev/pts",
+			Type:        "devpts",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NOEXEC,
+			Data:        devptsData,
+		},
+		{
+			Source:      "shm",
+			Destination: "/dev/shm",
+			Type:        "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
+			Data:        "mode=1777,size=65536k",
+		},
+		{
+			Source:      "mqueue",
+			Destination: "/dev/mqueue",
+			Type:        "mqueue",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
+		},
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 )
 
-func mountInit() error {
+// 初始化容器的挂载点和设备节点, 完成后切换rootfs, rootfs不为空时先在工作目录上挂载rootfs
+func mountInit(rootfs *Mount, mounts []Mount, devices []Device) error {
 	// 改变当前Namespace的Mount传播模式
 	err := syscall.Mount("", "/", "", uintptr(config.MountFlagsPrivate), "")
 	if err != nil {
@@ -22,25 +24,283 @@ func mountInit() error {
 	}
 	utils.LoggerUtil.Infof("pwd is %s", pwd)
 
+	if rootfs != nil {
+		if err = mountRootfs(pwd, rootfs); err != nil {
+			return err
+		}
+	}
+
+	// bind挂载的source和user namespace中bind挂载的设备均为宿主机路径, 所有挂载需要在切换rootfs之前按顺序完成
+	for _, mount := range mounts {
+		if err = mountToRoot(pwd, mount); err != nil {
+			return err
+		}
+	}
+
+	// 在容器 /dev 下创建设备节点和标准链接
+	if err = setupDevices(pwd, devices); err != nil {
+		return fmt.Errorf("device init failed: %v", err)
+	}
+
 	// 调用pivot切换rootfs
-	err = pivotRoot(pwd)
+	return pivotRoot(pwd)
+}
+
+// 屏蔽敏感路径, 目录挂载只读的空tmpfs, 文件挂载 /dev/null, 需要在创建设备节点之后调用
+func maskPaths(paths []string) error {
+	for _, maskPath := range paths {
+		info, err := os.Stat(maskPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("stat %s failed: %v", maskPath, err)
+		}
+
+		if info.IsDir() {
+			err = syscall.Mount("tmpfs", maskPath, "tmpfs", syscall.MS_RDONLY, "")
+		} else {
+			err = syscall.Mount("/dev/null", maskPath, "", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("mask %s failed: %v", maskPath, err)
+		}
+	}
+
+	return nil
+}
+
+// 将路径bind挂载到自身后重新挂载为只读
+func readonlyPaths(paths []string) error {
+	for _, readonlyPath := range paths {
+		err := syscall.Mount(readonlyPath, readonlyPath, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("bind %s failed: %v", readonlyPath, err)
+		}
+
+		flags, err := getMountLockedFlags(readonlyPath)
+		if err != nil {
+			return err
+		}
+		flags |= syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_REC
+		if err = syscall.Mount(readonlyPath, readonlyPath, "", flags, ""); err != nil {
+			return fmt.Errorf("remount %s readonly failed: %v", readonlyPath, err)
+		}
+	}
+
+	return nil
+}
+
+// 将已切换的根文件系统重新挂载为只读, 需要在创建挂载点和工作目录之后调用
+func remountRootReadonly() error {
+	flags, err := getMountLockedFlags("/")
 	if err != nil {
 		return err
 	}
+	flags |= syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY
+	if err = syscall.Mount("", "/", "", flags, ""); err != nil {
+		return fmt.Errorf("remount / readonly failed: %v", err)
+	}
+
+	return nil
+}
+
+// bind remount时需要从原挂载点继承的标志, 由statfs返回的ST_*标志转换为对应的MS_*标志
+var mountLockedFlags = [][2]uint64{
+	{stNoSuid, syscall.MS_NOSUID},
+	{stNoDev, syscall.MS_NODEV},
+	{stNoExec, syscall.MS_NOEXEC},
+	{stNoAtime, syscall.MS_NOATIME},
+	{stNoDiratime, syscall.MS_NODIRATIME},
+	{stRelatime, syscall.MS_RELATIME},
+}
+
+// 获取挂载点当前的nosuid/nodev/noexec等标志, bind remount时需要保留这些标志
+// 否则会清除原有的标志, 在user namespace中这些标志被锁定, 清除时remount会返回EPERM
+func getMountLockedFlags(mountPath string) (uintptr, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPath, &stat); err != nil {
+		return 0, fmt.Errorf("statfs %s failed: %v", mountPath, err)
+	}
+
+	var flags uintptr
+	for _, lockedFlag := range mountLockedFlags {
+		if uint64(stat.Flags)&lockedFlag[0] != 0 {
+			flags |= uintptr(lockedFlag[1])
+		}
+	}
+
+	return flags, nil
+}
+
+// ParseTmpfsMount 解析 --tmpfs 参数, 格式为 path[:options], 默认使用 noexec,nosuid,nodev
+// options中的挂载标志转换为mount flags, 其余选项如 size=64m,mode=1777 作为tmpfs参数
+func ParseTmpfsMount(tmpfsSpec string) (*Mount, error) {
+	destination, options := tmpfsSpec, ""
+	if idx := strings.Index(tmpfsSpec, ":"); idx >= 0 {
+		destination, options = tmpfsSpec[:idx], tmpfsSpec[idx+1:]
+	}
+	if !filepath.IsAbs(destination) || filepath.Clean(destination) == "/" {
+		return nil, fmt.Errorf("invalid tmpfs %q, format: path[:options]", tmpfsSpec)
+	}
+
+	mount := &Mount{
+		Source:      "tmpfs",
+		Destination: filepath.Clean(destination),
+		Type:        "tmpfs",
+		Flags:       syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV,
+	}
+	var data []string
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "":
+		case "ro":
+			mount.Flags |= syscall.MS_RDONLY
+		case "rw":
+			mount.Flags &^= syscall.MS_RDONLY
+		case "exec":
+			mount.Flags &^= syscall.MS_NOEXEC
+		case "noexec":
+			mount.Flags |= syscall.MS_NOEXEC
+		case "suid":
+			mount.Flags &^= syscall.MS_NOSUID
+		case "nosuid":
+			mount.Flags |= syscall.MS_NOSUID
+		case "dev":
+			mount.Flags &^= syscall.MS_NODEV
+		case "nodev":
+			mount.Flags |= syscall.MS_NODEV
+		default:
+			data = append(data, option)
+		}
+	}
+	mount.Data = strings.Join(data, ",")
+
+	return mount, nil
+}
+
+// 将文件系统挂载到rootfs下, 挂载点不存在时创建, bind挂载的source为宿主机路径, 按source的类型创建挂载点
+func mountToRoot(root string, mount Mount) error {
+	// 挂载点由镜像内容决定, 按rootfs解析其中的符号链接, 避免在宿主机路径上创建文件和挂载
+	target, err := resolveTargetInRoot(root, mount.Destination)
+	if err != nil {
+		return fmt.Errorf("resolve mount point %s failed: %v", mount.Destination, err)
+	}
+	// 重新挂载已有的挂载点, 如将bind挂载或tmpfs设置为只读
+	if mount.Flags&syscall.MS_REMOUNT != 0 {
+		if err = syscall.Mount(mount.Source, target, mount.Type, mount.Flags, mount.Data); err != nil {
+			return fmt.Errorf("remount %s failed: %v", mount.Destination, err)
+		}
+		return nil
+	}
 
-	// mount /proc directory
-	_ = os.Mkdir("/proc", 1555)
-	err = syscall.Mount("proc", "/proc", "proc", uintptr(config.MountFlagsDefault), "")
+	isDir := true
+	if mount.Flags&syscall.MS_BIND != 0 {
+		sourceInfo, err := os.Stat(mount.Source)
+		if err != nil {
+			return fmt.Errorf("bind mount source %s error: %v", mount.Source, err)
+		}
+		isDir = sourceInfo.IsDir()
+	}
+
+	// 挂载点本身为符号链接时删除后重新创建
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(target); err != nil {
+			return fmt.Errorf("remove symlink %s failed: %v", mount.Destination, err)
+		}
+	}
+	if isDir {
+		err = os.MkdirAll(target, 0755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		var file *os.File
+		if file, err = os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0644); err == nil {
+			err = file.Close()
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("mount /proc failed: %v", err)
+		return fmt.Errorf("create mount point %s failed: %v", mount.Destination, err)
 	}
 
-	_ = os.Mkdir("/dev", 1755)
-	err = syscall.Mount(
-		"tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755",
-	)
+	if err = syscall.Mount(mount.Source, target, mount.Type, mount.Flags, mount.Data); err != nil {
+		return fmt.Errorf("mount %s failed: %v", mount.Destination, err)
+	}
+
+	return nil
+}
+
+// 获取rootfs内的目标路径, 父目录按rootfs解析符号链接, 最后一级路径不解析, 由调用方决定是否替换
+func resolveTargetInRoot(root, destination string) (string, error) {
+	destination = filepath.Clean("/" + destination)
+	parent, err := resolveInRoot(root, filepath.Dir(destination))
 	if err != nil {
-		return fmt.Errorf("mount /dev failed: %v", err)
+		return "", err
+	}
+
+	return filepath.Join(parent, filepath.Base(destination)), nil
+}
+
+// 在rootfs内逐级解析路径, 符号链接以rootfs为根解析, 不会解析到rootfs之外, 返回宿主机上的路径
+// 已存在的路径必须为目录, 不存在的部分按字面拼接, 由调用方创建
+func resolveInRoot(root, unsafePath string) (string, error) {
+	resolved, remaining := "/", unsafePath
+	linksWalked := 0
+	for remaining != "" {
+		part := remaining
+		remaining = ""
+		if idx := strings.IndexByte(part, '/'); idx >= 0 {
+			part, remaining = part[:idx], part[idx+1:]
+		}
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("lstat %s error, %v", next, err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", next)
+			}
+			resolved = next
+			continue
+		}
+
+		if linksWalked++; linksWalked > maxSymlinksWalked {
+			return "", fmt.Errorf("too many symlinks in %s", unsafePath)
+		}
+		link, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", fmt.Errorf("readlink %s error, %v", next, err)
+		}
+		if filepath.IsAbs(link) {
+			resolved = "/"
+		}
+		remaining = link + "/" + remaining
+	}
+
+	return filepath.Join(root, resolved), nil
+}
+
+// 在工作目录上挂载rootfs, 挂载后需要重新进入该目录才能访问rootfs中的内容
+func mountRootfs(root string, rootfs *Mount) error {
+	if err := syscall.Mount(rootfs.Source, root, rootfs.Type, rootfs.Flags, rootfs.Data); err != nil {
+		return fmt.Errorf("mount rootfs failed: %v", err)
+	}
+	if err := syscall.Chdir(root); err != nil {
+		return fmt.Errorf("chdir %s failed: %v", root, err)
 	}
 
 	return nil
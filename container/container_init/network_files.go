@@ -0,0 +1,126 @@
+package container_init
+
+import (
+	"docker/container/container_info"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// 宿主机dns配置不可用时使用的dns服务器
+var defaultDnsServers = []string{"8.8.8.8", "8.8.4.4"}
+
+// SetupNetworkFiles 在容器信息目录下生成hosts, resolv.conf和hostname文件
+// 返回将这些文件挂载到容器 /etc 下的bind挂载点
+func SetupNetworkFiles(containerName string, conf *NetworkFilesConfig) ([]Mount, error) {
+	infoDirPath := container_info.GetContainerInfoDirPath(containerName)
+	if err := os.MkdirAll(infoDirPath, 0755); err != nil {
+		return nil, fmt.Errorf("container info mkdir error, %v", err)
+	}
+
+	resolvContent, err := buildResolvConf(conf.Dns)
+	if err != nil {
+		return nil, err
+	}
+	files := []struct {
+		name    string
+		content string
+	}{
+		{hostsFileName, buildHosts(conf)},
+		{resolvFileName, resolvContent},
+		{hostnameFileName, conf.Hostname + "\n"},
+	}
+
+	var mounts []Mount
+	for _, file := range files {
+		filePath := path.Join(infoDirPath, file.name)
+		if err = os.WriteFile(filePath, []byte(file.content), 0644); err != nil {
+			return nil, fmt.Errorf("%s write error, %v", filePath, err)
+		}
+		mounts = append(mounts, Mount{
+			Source:      filePath,
+			Destination: path.Join("/etc", file.name),
+			Type:        "bind",
+			Flags:       syscall.MS_BIND,
+		})
+	}
+
+	return mounts, nil
+}
+
+// ParseExtraHost 解析 host:ip 格式的hosts记录, ip可以为ipv6地址
+func ParseExtraHost(extraHost string) (string, string, error) {
+	idx := strings.Index(extraHost, ":")
+	if idx <= 0 || net.ParseIP(extraHost[idx+1:]) == nil {
+		return "", "", fmt.Errorf("invalid add-host %q, format: host:ip", extraHost)
+	}
+
+	return extraHost[:idx], extraHost[idx+1:], nil
+}
+
+// 生成容器的hosts文件内容
+func buildHosts(conf *NetworkFilesConfig) string {
+	var builder strings.Builder
+	builder.WriteString("127.0.0.1\tlocalhost\n")
+	builder.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if conf.IpAddr != "" {
+		ip, _, err := net.ParseCIDR(conf.IpAddr)
+		if err == nil {
+			builder.WriteString(fmt.Sprintf("%s\t%s\n", ip, conf.Hostname))
+		}
+	}
+	for _, extraHost := range conf.ExtraHosts {
+		host, ip, err := ParseExtraHost(extraHost)
+		if err != nil {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("%s\t%s\n", ip, host))
+	}
+
+	return builder.String()
+}
+
+// 生成容器的resolv.conf文件内容
+// 未指定dns时使用宿主机的配置, 并去掉容器内无法访问的本地回环地址, 没有可用的dns时使用默认dns
+func buildResolvConf(dnsServers []string) (string, error) {
+	var lines []string
+	if len(dnsServers) == 0 {
+		content, err := os.ReadFile(hostResolvFilePath)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("host resolv.conf read error, %v", err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+				continue
+			}
+			if fields[0] == "nameserver" {
+				if len(fields) < 2 {
+					continue
+				}
+				if ip := net.ParseIP(fields[1]); ip == nil || ip.IsLoopback() {
+					continue
+				}
+				dnsServers = append(dnsServers, fields[1])
+				continue
+			}
+			lines = append(lines, strings.Join(fields, " "))
+		}
+		if len(dnsServers) == 0 {
+			dnsServers = defaultDnsServers
+		}
+	}
+
+	var builder strings.Builder
+	for _, server := range dnsServers {
+		builder.WriteString("nameserver " + server + "\n")
+	}
+	for _, line := range lines {
+		builder.WriteString(line + "\n")
+	}
+
+	return builder.String(), nil
+}
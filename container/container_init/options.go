@@ -0,0 +1,109 @@
+package container_init
+
+import (
+	"docker/container/seccomp"
+	"os"
+	"syscall"
+)
+
+// InitConfig 通过pipe传递给容器init进程的配置, 以json格式传输
+type InitConfig struct {
+	Version  int      `json:"version"`
+	Args     []string `json:"args"`     // 用户进程的argv, 与用户输入完全一致
+	Env      []string `json:"env"`      // 用户进程的完整环境变量
+	Cwd      string   `json:"cwd"`      // 用户进程的工作目录, 为空时使用 "/"
+	User     string   `json:"user"`     // 用户进程的运行用户, 为空时使用root
+	Hostname string   `json:"hostname"` // 容器的主机名
+	Mounts   []Mount  `json:"mounts"`   // 切换rootfs后按顺序挂载的文件系统
+	Init     bool     `json:"init"`     // 是否保留init进程作为容器的1号进程
+	Devices  []Device `json:"devices"`  // 挂载完成后在容器 /dev 下创建的设备节点, user namespace中改为bind挂载宿主机设备
+	Terminal bool     `json:"terminal"` // 是否为用户进程分配伪终端, master通过console socket发送给宿主机
+	Readonly bool     `json:"readonly"` // 是否以只读方式挂载容器的根文件系统
+
+	MaskedPaths   []string `json:"masked_paths"`   // 容器内屏蔽的敏感路径
+	ReadonlyPaths []string `json:"readonly_paths"` // 容器内只读的敏感路径
+	Capabilities  []string `json:"capabilities"`   // 用户进程保留的capability
+
+	Seccomp *seccomp.Profile `json:"seccomp,omitempty"` // 用户进程的seccomp配置, 为空时不过滤系统调用
+	Rootfs  *Mount           `json:"rootfs,omitempty"`  // rootless模式下由init进程在工作目录上挂载的rootfs, 为空时已由宿主机挂载
+}
+
+// Mount 容器内的单个挂载点, 参数与mount(2)一致
+type Mount struct {
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Type        string  `json:"type"`
+	Flags       uintptr `json:"flags"`
+	Data        string  `json:"data,omitempty"`
+}
+
+// Device 容器内的设备节点, 参数与mknod(2)一致
+type Device struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"` // c: 字符设备, b: 块设备
+	Major    uint32      `json:"major"`
+	Minor    uint32      `json:"minor"`
+	FileMode os.FileMode `json:"file_mode"`
+	Uid      uint32      `json:"uid"`
+	Gid      uint32      `json:"gid"`
+	HostPath string      `json:"host_path,omitempty"` // 无法创建设备节点时bind挂载的宿主机设备, 为空时与Path相同
+}
+
+// IdMappings user namespace的uid/gid映射, 为容器内id到宿主机id的连续范围
+type IdMappings struct {
+	UidMaps []syscall.SysProcIDMap
+	GidMaps []syscall.SysProcIDMap
+}
+
+// NetworkFilesConfig 生成容器 /etc/hosts, /etc/resolv.conf 和 /etc/hostname 的参数
+type NetworkFilesConfig struct {
+	Hostname   string
+	IpAddr     string   // 容器ip, 格式为 ip/mask, 未加入网络时为空
+	ExtraHosts []string // 额外的hosts记录, 格式为 host:ip
+	Dns        []string // dns服务器, 为空时使用宿主机的配置
+}
+
+const (
+	// init配置格式版本, 修改InitConfig结构时递增
+	InitConfigVersion = 1
+
+	// init进程读取配置使用的文件描述符, 即 cmd.ExtraFiles[0]
+	initPipeFd = 3
+	// 分配伪终端时发送master使用的文件描述符, 即 cmd.ExtraFiles[1]
+	consoleSocketFd = 4
+
+	// 容器信息目录下生成的网络配置文件, 以bind方式挂载到容器rootfs
+	hostsFileName    = "hosts"
+	resolvFileName   = "resolv.conf"
+	hostnameFileName = "hostname"
+
+	// 设备类型
+	DeviceTypeChar  = "c"
+	DeviceTypeBlock = "b"
+
+	// 宿主机dns配置文件
+	hostResolvFilePath = "/etc/resolv.conf"
+
+	// 容器内cgroup的挂载路径和文件系统类型
+	cgroupMountPath = "/sys/fs/cgroup"
+	cgroupV1FsType  = "cgroup"
+	cgroupV2FsType  = "cgroup2"
+
+	// cgroup namespace模式, host: 与宿主机共享, private: 独立的cgroup namespace
+	CgroupNsHost    = "host"
+	CgroupNsPrivate = "private"
+
+	// rootless模式下overlay使用user命名空间的xattr, 非root用户无法设置trusted命名空间的xattr
+	overlayRootlessOption = "userxattr"
+
+	// 在rootfs内解析路径时允许的最大符号链接数量, 与linux的MAXSYMLINKS一致
+	maxSymlinksWalked = 40
+
+	// statfs(2) 返回的挂载标志, 与mount(2)使用的MS_*标志取值不完全相同
+	stNoSuid     = 0x2
+	stNoDev      = 0x4
+	stNoExec     = 0x8
+	stNoAtime    = 0x400
+	stNoDiratime = 0x800
+	stRelatime   = 0x1000
+)
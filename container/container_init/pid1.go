@@ -0,0 +1,80 @@
+package container_init
+
+import (
+	"docker/utils"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// 作为容器的1号进程运行:
+//  1. 在新的进程组中启动用户进程, 标准输入为终端时将该进程组设置为前台进程组
+//  2. 将收到的信号转发给用户进程组
+//  3. 回收所有退出的子进程, 包括被托管给1号进程的孤儿进程
+//  4. 用户进程退出后以用户进程的退出码退出, 被信号终止时退出码为 128+信号值
+func runInitProcess(cmdPath string, argv, env []string) error {
+	// 在启动子进程前注册信号, 避免遗漏子进程的SIGCHLD
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	sysAttr := &syscall.SysProcAttr{Setpgid: true}
+	if isTerminal(os.Stdin.Fd()) {
+		sysAttr.Foreground = true
+		sysAttr.Ctty = int(os.Stdin.Fd())
+	}
+	pid, err := syscall.ForkExec(cmdPath, argv, &syscall.ProcAttr{
+		Env:   env,
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
+		Sys:   sysAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("start user process error, %v", err)
+	}
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exitCode, exited := reapChildren(pid); exited {
+				os.Exit(exitCode)
+			}
+		case syscall.SIGURG: // go runtime用于抢占调度的信号, 不转发
+		default:
+			if err = syscall.Kill(-pid, sig.(syscall.Signal)); err != nil && err != syscall.ESRCH {
+				utils.LoggerUtil.Errorf("forward signal %v error, %v", sig, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 回收所有已退出的子进程, 用户进程已退出时返回其退出码
+func reapChildren(childPid int) (int, bool) {
+	exitCode, exited := 0, false
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return exitCode, exited
+		}
+		if pid != childPid {
+			continue
+		}
+
+		exited = true
+		exitCode = status.ExitStatus()
+		if status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		}
+	}
+}
+
+// 判断文件描述符是否为终端
+func isTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+
+	return errno == 0
+}
@@ -0,0 +1,177 @@
+package container_init
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// 容器rootfs中的用户和用户组文件, 需要在切换rootfs之后读取
+	passwdFilePath = "/etc/passwd"
+	groupFilePath  = "/etc/group"
+)
+
+// 解析后的容器进程用户
+type execUser struct {
+	Uid    int
+	Gid    int
+	Groups []int // 附加用户组
+	Home   string
+}
+
+// 切换init进程的用户, 为空时保持root
+func setupUser(user string, env []string) ([]string, error) {
+	if user == "" {
+		return env, nil
+	}
+
+	spec, err := resolveUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// 需要先切换用户组, 切换uid后将失去修改gid的权限
+	if err = syscall.Setgroups(spec.Groups); err != nil {
+		return nil, fmt.Errorf("setgroups error, %v", err)
+	}
+	if err = syscall.Setgid(spec.Gid); err != nil {
+		return nil, fmt.Errorf("setgid %d error, %v", spec.Gid, err)
+	}
+	if err = syscall.Setuid(spec.Uid); err != nil {
+		return nil, fmt.Errorf("setuid %d error, %v", spec.Uid, err)
+	}
+
+	return withHomeEnv(env, spec.Home), nil
+}
+
+// 解析 user[:group] 格式的用户, user和group可以为名称或数字id
+// 名称按容器rootfs中的 /etc/passwd 和 /etc/group 解析, 附加用户组为 /etc/group 中包含该用户的组
+// 未指定group时使用passwd中记录的gid, 用户不在passwd中时gid为0
+func resolveUser(user string) (*execUser, error) {
+	userPart, groupPart := user, ""
+	if idx := strings.Index(user, ":"); idx >= 0 {
+		userPart, groupPart = user[:idx], user[idx+1:]
+	}
+	if userPart == "" {
+		return nil, fmt.Errorf("invalid user %q", user)
+	}
+
+	passwdEntries, err := readColonFile(passwdFilePath)
+	if err != nil {
+		return nil, err
+	}
+	result := &execUser{Home: "/"}
+	userName := ""
+	uid, uidErr := strconv.Atoi(userPart)
+	found := false
+	for _, entry := range passwdEntries {
+		// name:password:uid:gid:gecos:home:shell
+		if len(entry) < 7 {
+			continue
+		}
+		entryUid, err := strconv.Atoi(entry[2])
+		if err != nil {
+			continue
+		}
+		if (uidErr == nil && entryUid == uid) || (uidErr != nil && entry[0] == userPart) {
+			userName = entry[0]
+			result.Uid = entryUid
+			result.Gid, _ = strconv.Atoi(entry[3])
+			result.Home = entry[5]
+			found = true
+			break
+		}
+	}
+	if !found {
+		if uidErr != nil {
+			return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userPart)
+		}
+		result.Uid = uid
+	}
+
+	groupEntries, err := readColonFile(groupFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if groupPart != "" {
+		if result.Gid, err = resolveGroup(groupPart, groupEntries); err != nil {
+			return nil, err
+		}
+	}
+
+	// name:password:gid:member1,member2
+	result.Groups = []int{}
+	for _, entry := range groupEntries {
+		if userName == "" || len(entry) < 4 {
+			continue
+		}
+		gid, err := strconv.Atoi(entry[2])
+		if err != nil {
+			continue
+		}
+		for _, member := range strings.Split(entry[3], ",") {
+			if member == userName && gid != result.Gid {
+				result.Groups = append(result.Groups, gid)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// 解析用户组名称或gid
+func resolveGroup(group string, groupEntries [][]string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	for _, entry := range groupEntries {
+		if len(entry) >= 3 && entry[0] == group {
+			return strconv.Atoi(entry[2])
+		}
+	}
+
+	return 0, fmt.Errorf("unable to find group %s: no matching entries in group file", group)
+}
+
+// 读取 /etc/passwd 格式的文件, 按 ":" 拆分每一行, 文件不存在时返回空
+func readColonFile(filePath string) ([][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open %s error, %v", filePath, err)
+	}
+	defer file.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s error, %v", filePath, err)
+	}
+
+	return entries, nil
+}
+
+// 环境变量中未设置HOME时使用用户的home目录
+func withHomeEnv(env []string, home string) []string {
+	for _, item := range env {
+		if strings.HasPrefix(item, "HOME=") {
+			return env
+		}
+	}
+
+	return append(env, "HOME="+home)
+}
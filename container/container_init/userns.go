@@ -0,0 +1,133 @@
+package container_init
+
+import (
+	"docker/container/container_info"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// 宿主机的用户和subordinate id配置文件
+	hostPasswdFilePath = "/etc/passwd"
+	hostGroupFilePath  = "/etc/group"
+	subUidFilePath     = "/etc/subuid"
+	subGidFilePath     = "/etc/subgid"
+)
+
+// ParseUsernsRemap 解析 --userns-remap 参数, 格式为 user[:group], user和group可以为宿主机上的名称或数字id
+// 按 /etc/subuid 和 /etc/subgid 中该用户的id范围依次映射为容器内从0开始的连续id, 未指定group时与user同名
+func ParseUsernsRemap(remapSpec string) (*IdMappings, error) {
+	userPart, groupPart := remapSpec, remapSpec
+	if idx := strings.Index(remapSpec, ":"); idx >= 0 {
+		userPart, groupPart = remapSpec[:idx], remapSpec[idx+1:]
+	}
+	if userPart == "" || groupPart == "" {
+		return nil, fmt.Errorf("invalid userns-remap %q, format: user[:group]", remapSpec)
+	}
+
+	uidMaps, err := readSubIdMaps(subUidFilePath, hostPasswdFilePath, userPart)
+	if err != nil {
+		return nil, err
+	}
+	gidMaps, err := readSubIdMaps(subGidFilePath, hostGroupFilePath, groupPart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdMappings{UidMaps: uidMaps, GidMaps: gidMaps}, nil
+}
+
+// rootless模式下非root用户只能将自身的uid/gid映射为容器内的root
+func rootlessIdMappings() *IdMappings {
+	return &IdMappings{
+		UidMaps: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}},
+		GidMaps: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}},
+	}
+}
+
+// 读取subuid/subgid文件中属于指定用户或用户组的id范围, 记录可以为名称或数字id
+func readSubIdMaps(subIdFilePath, nameFilePath, owner string) ([]syscall.SysProcIDMap, error) {
+	owners, err := resolveHostIdName(nameFilePath, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readColonFile(subIdFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var idMaps []syscall.SysProcIDMap
+	containerId := 0
+	for _, entry := range entries {
+		if len(entry) < 3 || !containsString(owners, entry[0]) {
+			continue
+		}
+		hostId, err := strconv.Atoi(entry[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s invalid entry %q", subIdFilePath, strings.Join(entry, ":"))
+		}
+		size, err := strconv.Atoi(entry[2])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("%s invalid entry %q", subIdFilePath, strings.Join(entry, ":"))
+		}
+		idMaps = append(idMaps, syscall.SysProcIDMap{ContainerID: containerId, HostID: hostId, Size: size})
+		containerId += size
+	}
+	if len(idMaps) == 0 {
+		return nil, fmt.Errorf("no subordinate ids for %s in %s", owner, subIdFilePath)
+	}
+
+	return idMaps, nil
+}
+
+// 获取宿主机用户或用户组的名称及数字id, subuid/subgid中的记录可以使用其中任意一种
+func resolveHostIdName(nameFilePath, owner string) ([]string, error) {
+	entries, err := readColonFile(nameFilePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if len(entry) >= 3 && (entry[0] == owner || entry[2] == owner) {
+			return []string{entry[0], entry[2]}, nil
+		}
+	}
+
+	// 不在passwd/group中的数字id直接使用
+	if _, err = strconv.Atoi(owner); err == nil {
+		return []string{owner}, nil
+	}
+
+	return nil, fmt.Errorf("%s not found in %s", owner, nameFilePath)
+}
+
+// 判断字符串是否在列表中
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowContainerInfoAccess 为容器信息目录及其上级目录增加执行权限
+// 映射后的容器root在宿主机上为普通用户, 需要访问目录下的hosts等文件以完成bind挂载
+func AllowContainerInfoAccess(containerName string) error {
+	infoDirPath := container_info.GetContainerInfoDirPath(containerName)
+	for _, dirPath := range []string{path.Dir(path.Dir(infoDirPath)), path.Dir(infoDirPath), infoDirPath} {
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			return fmt.Errorf("stat %s error, %v", dirPath, err)
+		}
+		if err = os.Chmod(dirPath, info.Mode().Perm()|0111); err != nil {
+			return fmt.Errorf("chmod %s error, %v", dirPath, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"crypto/sha256"
+	"docker/config"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// 构建缓存条目, 记录某个构建步骤生成的layer
+type buildCacheEntry struct {
+	Instruction string `json:"instruction"`
+	Layer       string `json:"layer"`
+}
+
+// GetBuildCacheKey 计算构建步骤的缓存key
+// key由父layer链、执行时的容器config以及指令内容共同决定
+func GetBuildCacheKey(parentLayers []string, conf *ContainerConfig, instruction string) (string, error) {
+	confBytes, err := json.Marshal(conf)
+	if err != nil {
+		return "", fmt.Errorf("container config marshal error, %v", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(strings.Join(parentLayers, ",")))
+	hash.Write([]byte("\n"))
+	hash.Write(confBytes)
+	hash.Write([]byte("\n"))
+	hash.Write([]byte(instruction))
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetFilesDigest 计算文件/目录内容的digest, 与文件修改时间无关, 用于COPY步骤的缓存key
+// 目录按其中的内容计算, 包含各文件的相对路径、权限、属主、符号链接目标和文件内容
+func GetFilesDigest(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, rootPath := range paths {
+		// 与 cp -a 保持一致, 目录(包括指向目录的符号链接)复制其中的内容
+		if stat, err := os.Stat(rootPath); err == nil && stat.IsDir() {
+			rootPath += "/."
+		}
+		err := filepath.Walk(rootPath, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(rootPath, filePath)
+			if err != nil {
+				return err
+			}
+
+			var link string
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(filePath); err != nil {
+					return err
+				}
+			}
+			var uid, gid uint32
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+				uid, gid = stat.Uid, stat.Gid
+			}
+			_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%d:%d\x00%s\x00", relPath, info.Mode(), uid, gid, link)
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			file, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(hash, file)
+
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("files digest compute error, %v", err)
+		}
+		hash.Write([]byte("\n"))
+	}
+
+	return DigestAlgorithm + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetBuildCache 查询构建缓存, 缓存的layer已被删除时视为未命中
+func GetBuildCache(key string) (string, bool) {
+	entry := &buildCacheEntry{}
+	if err := readJSONFile(getBuildCachePath(key), entry); err != nil {
+		return "", false
+	}
+
+	layerExists, err := IsLayerExists(entry.Layer)
+	if err != nil || !layerExists {
+		return "", false
+	}
+
+	return entry.Layer, true
+}
+
+// SaveBuildCache 保存构建步骤生成的layer
+func SaveBuildCache(key, instruction, layer string) error {
+	if err := os.MkdirAll(config.PathBuildCache, 0755); err != nil {
+		return fmt.Errorf("build cache dir create error, %v", err)
+	}
+
+	entry := &buildCacheEntry{
+		Instruction: instruction,
+		Layer:       layer,
+	}
+	if err := writeJSONFile(getBuildCachePath(key), entry); err != nil {
+		return fmt.Errorf("build cache write error, %v", err)
+	}
+
+	return nil
+}
+
+// 获取构建缓存文件路径
+func getBuildCachePath(key string) string {
+	return path.Join(config.PathBuildCache, key+".json")
+}
@@ -0,0 +1,79 @@
+package image
+
+import (
+	"docker/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// docker save导出包中manifest.json的单个条目
+type dockerArchiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"` // layer tar包相对路径, 由最底层到最顶层排列
+}
+
+// LoadDockerArchive 从解压后的docker-archive目录中导入镜像
+// imageName为空时使用归档中记录的RepoTags作为镜像引用
+func LoadDockerArchive(archiveDir, imageName string) error {
+	content, err := os.ReadFile(path.Join(archiveDir, DockerArchiveManifestName))
+	if err != nil {
+		return fmt.Errorf("docker archive manifest read error, %v", err)
+	}
+	var manifests []dockerArchiveManifest
+	if err = json.Unmarshal(content, &manifests); err != nil {
+		return fmt.Errorf("docker archive manifest unmarshal error, %v", err)
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("docker archive contains no image")
+	}
+	if imageName != "" && len(manifests) > 1 {
+		return fmt.Errorf("docker archive contains %d images, image name not allowed", len(manifests))
+	}
+
+	for _, manifest := range manifests {
+		refs := manifest.RepoTags
+		if imageName != "" {
+			refs = []string{imageName}
+		}
+
+		img, err := loadDockerArchiveImage(archiveDir, &manifest)
+		if err != nil {
+			return fmt.Errorf("load image %v error, %v", refs, err)
+		}
+		for _, ref := range refs {
+			if err = AddReference(ref, img.Id); err != nil {
+				return err
+			}
+		}
+		utils.LoggerUtil.Infof("loaded image %s %v", img.Id, refs)
+	}
+
+	return nil
+}
+
+// 按顺序导入单个镜像的各层layer, 并保存镜像config
+func loadDockerArchiveImage(archiveDir string, manifest *dockerArchiveManifest) (*Image, error) {
+	configBytes, err := os.ReadFile(getArchiveFilePath(archiveDir, manifest.Config))
+	if err != nil {
+		return nil, fmt.Errorf("image config read error, %v", err)
+	}
+
+	layers := make([]string, 0, len(manifest.Layers))
+	for _, layerPath := range manifest.Layers {
+		digest, err := ImportLayer(getArchiveFilePath(archiveDir, layerPath))
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, digest)
+	}
+
+	return CreateImage(layers, configBytes)
+}
+
+// 获取归档内文件的路径, 避免恶意归档通过 ../ 访问归档目录之外的文件
+func getArchiveFilePath(archiveDir, relPath string) string {
+	return path.Join(archiveDir, path.Clean("/"+relPath))
+}
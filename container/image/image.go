@@ -0,0 +1,324 @@
+package image
+
+import (
+	"crypto/sha256"
+	"docker/config"
+	"docker/utils"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CreateImage 使用有序的layer列表和镜像config创建镜像, 镜像id为config的sha256 digest
+// configBytes为空时生成只包含rootfs的最简config, 相同config的镜像已存在时直接返回已有镜像
+// config中记录的diff ids必须与实际导入的layer一致
+func CreateImage(layers []string, configBytes []byte) (*Image, error) {
+	if configBytes == nil {
+		var err error
+		if configBytes, err = json.Marshal(newImageConfig(layers)); err != nil {
+			return nil, fmt.Errorf("image config marshal error, %v", err)
+		}
+	}
+	if err := verifyDiffIds(configBytes, layers); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(configBytes)
+	imageId := DigestAlgorithm + ":" + hex.EncodeToString(hash[:])
+	imageExists, err := IsImageExists(imageId)
+	if err != nil {
+		return nil, err
+	}
+	if imageExists {
+		return GetImage(imageId)
+	}
+
+	img := &Image{
+		Id:          imageId,
+		Layers:      layers,
+		CreatedTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err = img.dump(); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(getImageConfigPath(imageId), configBytes, 0644); err != nil {
+		return nil, fmt.Errorf("image config write error, %v", err)
+	}
+
+	return img, nil
+}
+
+// CreateChildImage 基于父镜像config创建新镜像
+// layers为新镜像的完整layer列表, containerConf为更新后的容器config, createdBy记录在镜像history中
+func CreateChildImage(parentConfig []byte, layers []string, containerConf *ContainerConfig, createdBy string) (*Image, error) {
+	// 使用map保留父镜像config中未解析的字段
+	imageConfig := make(map[string]interface{})
+	if parentConfig != nil {
+		if err := json.Unmarshal(parentConfig, &imageConfig); err != nil {
+			return nil, fmt.Errorf("parent image config unmarshal error, %v", err)
+		}
+	}
+	if _, exist := imageConfig["architecture"]; !exist {
+		imageConfig["architecture"] = runtime.GOARCH
+	}
+	if _, exist := imageConfig["os"]; !exist {
+		imageConfig["os"] = runtime.GOOS
+	}
+
+	// 合并容器config
+	confMap, ok := imageConfig["config"].(map[string]interface{})
+	if !ok {
+		confMap = make(map[string]interface{})
+	}
+	confBytes, err := json.Marshal(containerConf)
+	if err != nil {
+		return nil, fmt.Errorf("container config marshal error, %v", err)
+	}
+	newConfMap := make(map[string]interface{})
+	if err = json.Unmarshal(confBytes, &newConfMap); err != nil {
+		return nil, fmt.Errorf("container config unmarshal error, %v", err)
+	}
+	for key, value := range newConfMap {
+		confMap[key] = value
+	}
+	imageConfig["config"] = confMap
+
+	// layer digest即为diff id
+	created := time.Now().UTC().Format(time.RFC3339)
+	imageConfig["created"] = created
+	imageConfig["rootfs"] = map[string]interface{}{
+		"type":     "layers",
+		"diff_ids": layers,
+	}
+	history, _ := imageConfig["history"].([]interface{})
+	imageConfig["history"] = append(history, map[string]interface{}{
+		"created":    created,
+		"created_by": createdBy,
+	})
+
+	configBytes, err := json.Marshal(imageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("image config marshal error, %v", err)
+	}
+
+	return CreateImage(layers, configBytes)
+}
+
+// GetImage 根据镜像id读取镜像manifest
+func GetImage(imageId string) (*Image, error) {
+	content, err := os.ReadFile(getImageManifestPath(imageId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("image %s not exists", imageId)
+		}
+		return nil, fmt.Errorf("image manifest read error, %v", err)
+	}
+
+	img := &Image{}
+	if err = json.Unmarshal(content, img); err != nil {
+		return nil, fmt.Errorf("image manifest unmarshal error, %v", err)
+	}
+
+	return img, nil
+}
+
+// ResolveImage 根据镜像引用(name:tag, name@sha256:..., 镜像id或id前缀)查找镜像
+func ResolveImage(refStr string) (*Image, error) {
+	if strings.HasPrefix(refStr, DigestAlgorithm+":") {
+		return GetImage(refStr)
+	}
+
+	ref, err := ParseReference(refStr)
+	if err == nil {
+		if imageId, exist := lookupReference(ref); exist {
+			return GetImage(imageId)
+		}
+	}
+
+	// 尝试按镜像id前缀查找
+	if isHexString(refStr) {
+		images, err := ListImages()
+		if err != nil {
+			return nil, err
+		}
+		var matched []*Image
+		for _, img := range images {
+			if strings.HasPrefix(img.Id, DigestAlgorithm+":"+refStr) {
+				matched = append(matched, img)
+			}
+		}
+		if len(matched) == 1 {
+			return matched[0], nil
+		}
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("image id prefix %s is ambiguous", refStr)
+		}
+	}
+
+	return nil, fmt.Errorf("image %s not exists", refStr)
+}
+
+// GetConfig 读取镜像config
+func (img *Image) GetConfig() (*ImageConfig, error) {
+	content, err := img.GetRawConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	imageConfig := &ImageConfig{}
+	if err = json.Unmarshal(content, imageConfig); err != nil {
+		return nil, fmt.Errorf("image config unmarshal error, %v", err)
+	}
+
+	return imageConfig, nil
+}
+
+// GetRawConfig 读取镜像原始config json
+func (img *Image) GetRawConfig() ([]byte, error) {
+	content, err := os.ReadFile(getImageConfigPath(img.Id))
+	if err != nil {
+		return nil, fmt.Errorf("image config read error, %v", err)
+	}
+
+	return content, nil
+}
+
+// GetShortId 获取用于展示的短镜像id
+func (img *Image) GetShortId() string {
+	_, hexStr := splitDigest(img.Id)
+	if len(hexStr) > 12 {
+		return hexStr[:12]
+	}
+
+	return hexStr
+}
+
+// ListImages 获取所有镜像
+func ListImages() ([]*Image, error) {
+	imageDir := path.Join(config.PathImage, DigestAlgorithm)
+	entries, err := os.ReadDir(imageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list images error, %v", err)
+	}
+
+	var images []*Image
+	for _, entry := range entries {
+		imageId := DigestAlgorithm + ":" + entry.Name()
+		img, err := GetImage(imageId)
+		if err != nil {
+			utils.LoggerUtil.Errorf("read image %s error, %v", imageId, err)
+			continue
+		}
+		images = append(images, img)
+	}
+
+	return images, nil
+}
+
+// RemoveImage 删除镜像元信息以及指向该镜像的所有引用, 镜像的layer需要通过PruneLayers清理
+func RemoveImage(imageId string) error {
+	imageExists, err := IsImageExists(imageId)
+	if err != nil {
+		return err
+	}
+	if !imageExists {
+		return fmt.Errorf("image %s not exists", imageId)
+	}
+
+	if err = removeImageReferences(imageId); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(getImageDirPath(imageId)); err != nil {
+		return fmt.Errorf("image dir remove error, %v", err)
+	}
+
+	return nil
+}
+
+// GetSize 获取镜像所有layer占用的磁盘大小
+func (img *Image) GetSize() (int64, error) {
+	var size int64
+	for _, layer := range img.Layers {
+		layerSize, err := GetLayerSize(layer)
+		if err != nil {
+			return 0, err
+		}
+		size += layerSize
+	}
+
+	return size, nil
+}
+
+// IsImageExists 判断镜像是否已经存在
+func IsImageExists(imageId string) (bool, error) {
+	return utils.GeneralUtils.IsDirExists(getImageDirPath(imageId))
+}
+
+// 生成只包含rootfs信息的镜像config
+func newImageConfig(layers []string) map[string]interface{} {
+	return map[string]interface{}{
+		"architecture": runtime.GOARCH,
+		"os":           runtime.GOOS,
+		"config":       map[string]interface{}{},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": layers,
+		},
+	}
+}
+
+// 将镜像manifest写入镜像目录
+func (img *Image) dump() error {
+	if err := os.MkdirAll(getImageDirPath(img.Id), 0755); err != nil {
+		return fmt.Errorf("image dir create error, %v", err)
+	}
+
+	jsonBytes, err := json.Marshal(img)
+	if err != nil {
+		return fmt.Errorf("image manifest marshal error, %v", err)
+	}
+	if err = os.WriteFile(getImageManifestPath(img.Id), jsonBytes, 0644); err != nil {
+		return fmt.Errorf("image manifest write error, %v", err)
+	}
+
+	return nil
+}
+
+// 判断字符串是否全部为小写16进制字符
+func isHexString(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, c := range str {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 获取镜像元信息存放目录: {PathImage}/sha256/{hex}
+func getImageDirPath(imageId string) string {
+	algorithm, hexStr := splitDigest(imageId)
+
+	return path.Join(config.PathImage, algorithm, hexStr)
+}
+
+// 获取镜像manifest文件路径
+func getImageManifestPath(imageId string) string {
+	return path.Join(getImageDirPath(imageId), ImageManifestName)
+}
+
+// 获取镜像config文件路径
+func getImageConfigPath(imageId string) string {
+	return path.Join(getImageDirPath(imageId), ImageConfigName)
+}
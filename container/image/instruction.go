@@ -0,0 +1,142 @@
+package image
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ApplyConfigChange 将一条Dockerfile风格的指令应用到容器config上
+// 支持 CMD/ENTRYPOINT/ENV/WORKDIR/USER/EXPOSE, 如: `CMD ["sh"]`, `ENV FOO=bar`
+func ApplyConfigChange(conf *ContainerConfig, change string) error {
+	instruction, value := SplitInstruction(change)
+	if value == "" {
+		return fmt.Errorf("invalid change %q, missing value", change)
+	}
+
+	switch instruction {
+	case "CMD":
+		conf.Cmd = ParseCommandValue(value)
+	case "ENTRYPOINT":
+		conf.Entrypoint = ParseCommandValue(value)
+	case "ENV":
+		envs, err := parseEnvValue(value)
+		if err != nil {
+			return err
+		}
+		for _, env := range envs {
+			conf.Env = SetEnv(conf.Env, env)
+		}
+	case "WORKDIR":
+		if !path.IsAbs(value) {
+			value = path.Join("/", conf.WorkingDir, value)
+		}
+		conf.WorkingDir = path.Clean(value)
+	case "USER":
+		conf.User = value
+	case "EXPOSE":
+		if conf.ExposedPorts == nil {
+			conf.ExposedPorts = make(map[string]struct{})
+		}
+		for _, port := range strings.Fields(value) {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			conf.ExposedPorts[port] = struct{}{}
+		}
+	default:
+		return fmt.Errorf("unsupported instruction %s", instruction)
+	}
+
+	return nil
+}
+
+// ParseBuildFile 解析构建文件, 返回逻辑行形式的指令列表
+// 忽略空行和 # 开头的注释, 以 \ 结尾的行与下一行合并
+func ParseBuildFile(reader io.Reader) ([]string, error) {
+	var instructions []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if current.Len() == 0 && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\"))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(line)
+		instructions = append(instructions, strings.TrimSpace(current.String()))
+		current.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("build file read error, %v", err)
+	}
+	if current.Len() > 0 {
+		instructions = append(instructions, strings.TrimSpace(current.String()))
+	}
+
+	return instructions, nil
+}
+
+// SplitInstruction 拆分指令名和指令参数, 指令名统一转换为大写
+func SplitInstruction(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) < 2 {
+		return strings.ToUpper(parts[0]), ""
+	}
+
+	return strings.ToUpper(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// ParseCommandValue 解析命令参数, 支持json数组格式和shell格式, shell格式使用 /bin/sh -c 执行
+func ParseCommandValue(value string) []string {
+	if strings.HasPrefix(value, "[") {
+		var command []string
+		if err := json.Unmarshal([]byte(value), &command); err == nil {
+			return command
+		}
+	}
+
+	return []string{"/bin/sh", "-c", value}
+}
+
+// 解析ENV参数, 支持 `KEY=VALUE KEY2=VALUE2` 以及 `KEY VALUE` 两种格式
+func parseEnvValue(value string) ([]string, error) {
+	fields := strings.Fields(value)
+	if !strings.Contains(fields[0], "=") {
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid env %q", value)
+		}
+		return []string{fields[0] + "=" + strings.TrimSpace(strings.TrimPrefix(value, fields[0]))}, nil
+	}
+
+	for _, field := range fields {
+		if !strings.Contains(field, "=") {
+			return nil, fmt.Errorf("invalid env %q", field)
+		}
+	}
+
+	return fields, nil
+}
+
+// SetEnv 设置环境变量, 已存在同名变量时覆盖
+func SetEnv(envs []string, env string) []string {
+	key := strings.SplitN(env, "=", 2)[0]
+	for i, item := range envs {
+		if strings.SplitN(item, "=", 2)[0] == key {
+			envs[i] = env
+			return envs
+		}
+	}
+
+	return append(envs, env)
+}
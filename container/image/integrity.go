@@ -0,0 +1,199 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// layer导入时记录的完整性信息, 用于检测layer目录在磁盘上被损坏或篡改
+type layerIntegrity struct {
+	DiffId        string              `json:"diffId"`
+	ContentDigest string              `json:"contentDigest"` // 所有文件校验信息的sha256
+	Files         []layerFileChecksum `json:"files"`
+}
+
+// layer中单个文件的校验信息
+type layerFileChecksum struct {
+	Path   string `json:"path"`
+	Mode   uint32 `json:"mode"`
+	Uid    uint32 `json:"uid"`
+	Gid    uint32 `json:"gid"`
+	Size   int64  `json:"size,omitempty"`
+	Rdev   uint64 `json:"rdev,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Opaque bool   `json:"opaque,omitempty"`
+	Digest string `json:"digest,omitempty"` // 普通文件内容的sha256
+}
+
+// VerifyLayer 重新计算layer目录中所有文件的校验信息, 与导入时记录的信息比较
+func VerifyLayer(digest string) error {
+	recorded := &layerIntegrity{}
+	if err := readJSONFile(getLayerIntegrityPath(digest), recorded); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("layer %s has no integrity record", digest)
+		}
+		return fmt.Errorf("layer %s integrity record read error, %v", digest, err)
+	}
+	if recorded.DiffId != digest {
+		return fmt.Errorf("layer %s integrity record belongs to %s", digest, recorded.DiffId)
+	}
+
+	current, err := computeLayerIntegrity(digest, GetLayerDiffPath(digest))
+	if err != nil {
+		return err
+	}
+	if current.ContentDigest == recorded.ContentDigest {
+		return nil
+	}
+
+	return fmt.Errorf("layer %s content digest mismatch, expect %s, got %s, changed files: %v",
+		digest, recorded.ContentDigest, current.ContentDigest, diffLayerFiles(recorded.Files, current.Files))
+}
+
+// VerifyImage 校验镜像config与镜像id一致, config中的diff ids与镜像layer一致, 并校验每个layer的内容
+func VerifyImage(img *Image) error {
+	configBytes, err := img.GetRawConfig()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(configBytes)
+	if digest := DigestAlgorithm + ":" + hex.EncodeToString(hash[:]); digest != img.Id {
+		return fmt.Errorf("image config digest mismatch, expect %s, got %s", img.Id, digest)
+	}
+	if err = verifyDiffIds(configBytes, img.Layers); err != nil {
+		return err
+	}
+
+	for _, layer := range img.Layers {
+		if err = VerifyLayer(layer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 校验镜像config中记录的diff ids与实际导入的layer一致
+func verifyDiffIds(configBytes []byte, layers []string) error {
+	rootFS := &imageRootFS{}
+	if err := json.Unmarshal(configBytes, rootFS); err != nil {
+		return fmt.Errorf("image config unmarshal error, %v", err)
+	}
+
+	diffIds := rootFS.RootFS.DiffIds
+	if len(diffIds) != len(layers) {
+		return fmt.Errorf("image config has %d diff ids, image has %d layers", len(diffIds), len(layers))
+	}
+	for i := range diffIds {
+		if diffIds[i] != layers[i] {
+			return fmt.Errorf("layer %d diff id mismatch, expect %s, got %s", i, diffIds[i], layers[i])
+		}
+	}
+
+	return nil
+}
+
+// 计算layer目录的校验信息并写入layer目录
+func writeLayerIntegrity(layerPath, digest string) error {
+	integrity, err := computeLayerIntegrity(digest, path.Join(layerPath, LayerDiffDirName))
+	if err != nil {
+		return err
+	}
+	if err = writeJSONFile(path.Join(layerPath, LayerIntegrityName), integrity); err != nil {
+		return fmt.Errorf("layer integrity write error, %v", err)
+	}
+
+	return nil
+}
+
+// 按字典序遍历layer目录, 计算每个文件的校验信息
+func computeLayerIntegrity(digest, diffPath string) (*layerIntegrity, error) {
+	var files []layerFileChecksum
+	err := filepath.Walk(diffPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(diffPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		checksum := layerFileChecksum{Path: relPath, Mode: uint32(info.Mode())}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			checksum.Uid, checksum.Gid = stat.Uid, stat.Gid
+			if info.Mode()&os.ModeDevice != 0 {
+				checksum.Rdev = uint64(stat.Rdev)
+			}
+		}
+		switch {
+		case info.Mode().IsRegular():
+			checksum.Size = info.Size()
+			if checksum.Digest, err = computeFileDigest(filePath); err != nil {
+				return err
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			if checksum.Link, err = os.Readlink(filePath); err != nil {
+				return err
+			}
+		case info.IsDir():
+			checksum.Opaque = isOverlayOpaque(filePath)
+		}
+		files = append(files, checksum)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("layer %s checksum compute error, %v", digest, err)
+	}
+
+	content, err := json.Marshal(files)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(content)
+
+	return &layerIntegrity{
+		DiffId:        digest,
+		ContentDigest: DigestAlgorithm + ":" + hex.EncodeToString(hash[:]),
+		Files:         files,
+	}, nil
+}
+
+// 比较两次计算的文件校验信息, 返回新增、删除或修改的文件
+func diffLayerFiles(expect, actual []layerFileChecksum) []string {
+	expectMap := make(map[string]layerFileChecksum, len(expect))
+	for _, file := range expect {
+		expectMap[file.Path] = file
+	}
+
+	var changed []string
+	for _, file := range actual {
+		expectFile, exist := expectMap[file.Path]
+		if !exist {
+			changed = append(changed, "+"+file.Path)
+			continue
+		}
+		if expectFile != file {
+			changed = append(changed, "~"+file.Path)
+		}
+		delete(expectMap, file.Path)
+	}
+	for _, file := range expect {
+		if _, exist := expectMap[file.Path]; exist {
+			changed = append(changed, "-"+file.Path)
+		}
+	}
+
+	return changed
+}
+
+// 获取layer完整性信息文件路径
+func getLayerIntegrityPath(digest string) string {
+	return path.Join(getLayerPath(digest), LayerIntegrityName)
+}
@@ -0,0 +1,341 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"docker/config"
+	"docker/utils"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ImportLayer 将layer tar包导入layer store, 返回layer digest
+// layer以解压后tar包的sha256(即diff id)作为key, 相同内容的layer在磁盘上只保存一份
+func ImportLayer(layerTarPath string) (string, error) {
+	digest, err := computeLayerDigest(layerTarPath)
+	if err != nil {
+		return "", fmt.Errorf("layer digest compute error, %v", err)
+	}
+
+	layerExists, err := IsLayerExists(digest)
+	if err != nil {
+		return "", err
+	}
+	if layerExists { // 已存在相同layer, 校验完整后直接复用
+		if err = VerifyLayer(digest); err != nil {
+			return "", fmt.Errorf("existing layer is corrupted, %v", err)
+		}
+		utils.LoggerUtil.Infof("layer %s already exists", digest)
+		return digest, nil
+	}
+
+	// 先解压到临时目录, 完成后再rename, 避免中途失败留下不完整的layer
+	if err = os.MkdirAll(config.PathLayer, 0755); err != nil {
+		return "", fmt.Errorf("layer store mkdir error, %v", err)
+	}
+	tmpDir, err := os.MkdirTemp(config.PathLayer, "tmp-")
+	if err != nil {
+		return "", fmt.Errorf("layer tmp dir create error, %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	diffPath := path.Join(tmpDir, LayerDiffDirName)
+	if err = os.Mkdir(diffPath, 0755); err != nil {
+		return "", fmt.Errorf("layer diff dir create error, %v", err)
+	}
+	output, err := exec.Command("tar", "-xf", layerTarPath, "-C", diffPath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("layer untar error, %v, %s", err, output)
+	}
+	// 将AUFS风格的whiteout转换为overlayfs可识别的格式
+	if err = convertWhiteoutsToOverlay(diffPath); err != nil {
+		return "", err
+	}
+
+	// 记录layer中所有文件的校验信息, 用于之后检测磁盘上的损坏或篡改
+	if err = writeLayerIntegrity(tmpDir, digest); err != nil {
+		return "", err
+	}
+
+	layerPath := getLayerPath(digest)
+	if err = os.Chmod(tmpDir, 0755); err != nil {
+		return "", fmt.Errorf("layer dir chmod error, %v", err)
+	}
+	if err = os.MkdirAll(path.Dir(layerPath), 0755); err != nil {
+		return "", fmt.Errorf("layer dir create error, %v", err)
+	}
+	if err = os.Rename(tmpDir, layerPath); err != nil {
+		return "", fmt.Errorf("layer commit error, %v", err)
+	}
+
+	return digest, nil
+}
+
+// CommitLayer 将目录(如容器的overlay upperdir)打包并导入为新的layer, 返回layer digest
+func CommitLayer(diffPath string) (string, error) {
+	if err := os.MkdirAll(config.PathLayer, 0755); err != nil {
+		return "", fmt.Errorf("layer store mkdir error, %v", err)
+	}
+	tmpFile, err := os.CreateTemp(config.PathLayer, "commit-")
+	if err != nil {
+		return "", fmt.Errorf("layer tmp file create error, %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if err = ExportLayer(diffPath, tmpFile); err != nil {
+		return "", err
+	}
+
+	return ImportLayer(tmpFile.Name())
+}
+
+// ExportLayer 将layer目录打包为tar写入writer, overlayfs whiteout会被转换为OCI whiteout标记
+func ExportLayer(diffPath string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	hardLinks := make(map[uint64]string) // inode -> 首次出现的路径, 用于还原硬链接
+
+	err := filepath.Walk(diffPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(diffPath, filePath)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		// overlayfs whiteout转换为 .wh.{name} 空文件
+		if isOverlayWhiteout(info) {
+			dir, name := filepath.Split(relPath)
+			return tarWriter.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     filepath.Join(dir, whiteoutPrefix+name),
+				Mode:     0600,
+				ModTime:  info.ModTime(),
+			})
+		}
+
+		return writeTarEntry(tarWriter, filePath, relPath, info, hardLinks)
+	})
+	if err != nil {
+		return fmt.Errorf("layer tar error, %v", err)
+	}
+
+	return tarWriter.Close()
+}
+
+// 写入单个文件的tar entry
+func writeTarEntry(tarWriter *tar.Writer, filePath, relPath string, info os.FileInfo, hardLinks map[uint64]string) error {
+	var link string
+	var err error
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(filePath); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = relPath
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		header.Uid, header.Gid = int(stat.Uid), int(stat.Gid)
+		header.Uname, header.Gname = "", ""
+		// 多个路径指向同一inode时, 后续路径记录为硬链接
+		if info.Mode().IsRegular() && stat.Nlink > 1 {
+			if target, exist := hardLinks[stat.Ino]; exist {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = target
+				header.Size = 0
+			} else {
+				hardLinks[stat.Ino] = relPath
+			}
+		}
+	}
+
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// opaque目录在目录entry之后追加 .wh..wh..opq 标记
+	if info.IsDir() && isOverlayOpaque(filePath) {
+		return tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.Join(relPath, whiteoutOpaque),
+			Mode:     0600,
+			ModTime:  info.ModTime(),
+		})
+	}
+
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tarWriter, file)
+
+	return err
+}
+
+// GetLayerSize 获取layer解压后占用的磁盘大小
+func GetLayerSize(digest string) (int64, error) {
+	var size int64
+	err := filepath.Walk(GetLayerDiffPath(digest), func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("layer %s size compute error, %v", digest, err)
+	}
+
+	return size, nil
+}
+
+// PruneLayers 清理不被任何镜像引用的layer, retainLayers为需要额外保留的layer(如容器正在使用的layer)
+func PruneLayers(retainLayers []string) error {
+	images, err := ListImages()
+	if err != nil {
+		return err
+	}
+
+	// 统计仍被引用的layer
+	referenced := make(map[string]bool)
+	for _, layer := range retainLayers {
+		referenced[layer] = true
+	}
+	for _, img := range images {
+		for _, layer := range img.Layers {
+			referenced[layer] = true
+		}
+	}
+
+	layerDir := path.Join(config.PathLayer, DigestAlgorithm)
+	entries, err := os.ReadDir(layerDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read layer dir error, %v", err)
+	}
+	for _, entry := range entries {
+		digest := DigestAlgorithm + ":" + entry.Name()
+		if referenced[digest] {
+			continue
+		}
+		if err = os.RemoveAll(getLayerPath(digest)); err != nil {
+			return fmt.Errorf("remove layer %s error, %v", digest, err)
+		}
+		utils.LoggerUtil.Infof("deleted layer %s", digest)
+	}
+
+	return nil
+}
+
+// GetLayerLowerDirs 获取layer列表对应的目录, layers由最底层到最顶层排列, 返回结果按overlay lowerdir的要求由最顶层到最底层排列
+func GetLayerLowerDirs(layers []string) ([]string, error) {
+	lowerDirs := make([]string, 0, len(layers))
+	for i := len(layers) - 1; i >= 0; i-- {
+		layerExists, err := IsLayerExists(layers[i])
+		if err != nil {
+			return nil, err
+		}
+		if !layerExists {
+			return nil, fmt.Errorf("layer %s missing", layers[i])
+		}
+		lowerDirs = append(lowerDirs, GetLayerDiffPath(layers[i]))
+	}
+
+	return lowerDirs, nil
+}
+
+// IsLayerExists 判断指定digest的layer是否已经存在
+func IsLayerExists(digest string) (bool, error) {
+	return utils.GeneralUtils.IsDirExists(GetLayerDiffPath(digest))
+}
+
+// GetLayerDiffPath 获取layer解压后的文件目录, 作为overlay的lowerdir使用
+func GetLayerDiffPath(digest string) string {
+	return path.Join(getLayerPath(digest), LayerDiffDirName)
+}
+
+// 获取layer存放路径: {PathLayer}/sha256/{hex}
+func getLayerPath(digest string) string {
+	algorithm, hexStr := splitDigest(digest)
+
+	return path.Join(config.PathLayer, algorithm, hexStr)
+}
+
+// 拆分 "sha256:xxx" 格式的digest
+func splitDigest(digest string) (string, string) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return DigestAlgorithm, digest
+	}
+
+	return parts[0], parts[1]
+}
+
+// 计算layer tar包的diff id, gzip压缩的layer按解压后的内容计算
+func computeLayerDigest(layerTarPath string) (string, error) {
+	file, err := os.Open(layerTarPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var content io.Reader = reader
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b { // gzip magic number
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return "", err
+		}
+		defer gzipReader.Close()
+		content = gzipReader
+	}
+
+	return computeDigest(content)
+}
+
+// 计算文件内容的sha256 digest
+func computeFileDigest(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return computeDigest(file)
+}
+
+// 计算数据流的sha256 digest
+func computeDigest(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+
+	return DigestAlgorithm + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,340 @@
+package image
+
+import (
+	"crypto/sha256"
+	"docker/utils"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+)
+
+// oci-layout文件内容
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// region 导入OCI image layout
+
+// LoadOCILayout 从OCI image layout目录导入镜像, 导入前会校验每个blob的digest
+// imageName为空时使用index中记录的 org.opencontainers.image.ref.name 作为镜像引用, 都为空时导入为无引用的镜像
+func LoadOCILayout(layoutDir, imageName string) error {
+	layout := &ociLayout{}
+	if err := readJSONFile(path.Join(layoutDir, OCILayoutFileName), layout); err != nil {
+		return fmt.Errorf("oci-layout read error, %v", err)
+	}
+	if layout.ImageLayoutVersion != OCILayoutVersion {
+		return fmt.Errorf("unsupported oci layout version %s", layout.ImageLayoutVersion)
+	}
+
+	index := &Index{}
+	if err := readJSONFile(path.Join(layoutDir, OCIIndexFileName), index); err != nil {
+		return fmt.Errorf("oci index read error, %v", err)
+	}
+	manifestDesc, err := selectOCIManifest(layoutDir, index, imageName)
+	if err != nil {
+		return err
+	}
+
+	name := imageName
+	if name == "" {
+		name = manifestDesc.Annotations[OCIRefNameAnnotation]
+	}
+
+	manifest := &Manifest{}
+	if err = readOCIBlobJSON(layoutDir, manifestDesc, manifest); err != nil {
+		return fmt.Errorf("oci manifest read error, %v", err)
+	}
+	configBytes, err := readOCIBlob(layoutDir, manifest.Config)
+	if err != nil {
+		return fmt.Errorf("oci config read error, %v", err)
+	}
+
+	layers := make([]string, 0, len(manifest.Layers))
+	for _, layerDesc := range manifest.Layers {
+		if layerDesc.MediaType != MediaTypeOCILayer && layerDesc.MediaType != MediaTypeOCILayerGzip {
+			return fmt.Errorf("unsupported layer media type %s", layerDesc.MediaType)
+		}
+		blobPath := getOCIBlobPath(layoutDir, layerDesc.Digest)
+		if err = verifyBlob(blobPath, layerDesc.Digest); err != nil {
+			return err
+		}
+		digest, err := ImportLayer(blobPath)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, digest)
+	}
+
+	img, err := CreateImage(layers, configBytes)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		utils.LoggerUtil.Infof("loaded untagged image %s", img.Id)
+		return nil
+	}
+
+	// 同时记录 name:tag 和 name@manifest-digest 两个引用
+	ref, err := ParseReference(name)
+	if err != nil {
+		return err
+	}
+	if err = AddReference(ref.String(), img.Id); err != nil {
+		return err
+	}
+	ref.Digest = manifestDesc.Digest
+
+	return AddReference(ref.String(), img.Id)
+}
+
+// 从index中选出需要导入的manifest
+// 优先匹配ref name与镜像名相同的manifest, 嵌套的index按当前平台选择
+func selectOCIManifest(layoutDir string, index *Index, imageName string) (*Descriptor, error) {
+	candidates := index.Manifests
+	if imageName != "" {
+		var matched []Descriptor
+		for _, desc := range candidates {
+			if desc.Annotations[OCIRefNameAnnotation] == imageName {
+				matched = append(matched, desc)
+			}
+		}
+		if len(matched) > 0 {
+			candidates = matched
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no manifest found in oci index")
+	}
+
+	desc := &candidates[0]
+	for i := range candidates {
+		if isCurrentPlatform(candidates[i].Platform) {
+			desc = &candidates[i]
+			break
+		}
+	}
+	if desc.MediaType != MediaTypeOCIIndex {
+		return desc, nil
+	}
+
+	// 嵌套index, 继续选择当前平台的manifest
+	nestedIndex := &Index{}
+	if err := readOCIBlobJSON(layoutDir, desc, nestedIndex); err != nil {
+		return nil, fmt.Errorf("nested oci index read error, %v", err)
+	}
+	manifestDesc, err := selectOCIManifest(layoutDir, nestedIndex, "")
+	if err != nil {
+		return nil, err
+	}
+	if manifestDesc.Annotations == nil {
+		manifestDesc.Annotations = desc.Annotations
+	}
+
+	return manifestDesc, nil
+}
+
+// 判断platform是否与当前运行平台一致, 未指定platform视为一致
+func isCurrentPlatform(platform *Platform) bool {
+	return platform == nil || (platform.OS == runtime.GOOS && platform.Architecture == runtime.GOARCH)
+}
+
+// 读取blob内容并校验digest
+func readOCIBlob(layoutDir string, desc Descriptor) ([]byte, error) {
+	content, err := os.ReadFile(getOCIBlobPath(layoutDir, desc.Digest))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(content)
+	if digest := DigestAlgorithm + ":" + hex.EncodeToString(hash[:]); digest != desc.Digest {
+		return nil, fmt.Errorf("blob digest mismatch, expect %s, got %s", desc.Digest, digest)
+	}
+
+	return content, nil
+}
+
+// 读取blob内容并反序列化
+func readOCIBlobJSON(layoutDir string, desc *Descriptor, v interface{}) error {
+	content, err := readOCIBlob(layoutDir, *desc)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// 校验blob文件的digest
+func verifyBlob(blobPath, expectDigest string) error {
+	digest, err := computeFileDigest(blobPath)
+	if err != nil {
+		return fmt.Errorf("blob digest compute error, %v", err)
+	}
+	if digest != expectDigest {
+		return fmt.Errorf("blob digest mismatch, expect %s, got %s", expectDigest, digest)
+	}
+
+	return nil
+}
+
+// endregion
+
+// region 导出OCI image layout
+
+// SaveOCILayout 将镜像导出为OCI image layout目录, 使用name:tag导出时在index中记录ref name
+func SaveOCILayout(imageRef, layoutDir string) error {
+	img, err := ResolveImage(imageRef)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Join(layoutDir, OCIBlobsDirName, DigestAlgorithm), 0755); err != nil {
+		return fmt.Errorf("oci blobs dir create error, %v", err)
+	}
+
+	// 重新打包各层layer, 打包后的tar即为未压缩的layer blob
+	layerDescs := make([]Descriptor, 0, len(img.Layers))
+	diffIds := make([]string, 0, len(img.Layers))
+	for _, layer := range img.Layers {
+		diffPath := GetLayerDiffPath(layer)
+		desc, err := writeOCIBlob(layoutDir, func(writer io.Writer) error {
+			return ExportLayer(diffPath, writer)
+		})
+		if err != nil {
+			return fmt.Errorf("export layer %s error, %v", layer, err)
+		}
+		desc.MediaType = MediaTypeOCILayer
+		layerDescs = append(layerDescs, *desc)
+		diffIds = append(diffIds, desc.Digest)
+	}
+
+	configBytes, err := buildOCIConfig(img, diffIds)
+	if err != nil {
+		return err
+	}
+	configDesc, err := writeOCIBlobBytes(layoutDir, configBytes)
+	if err != nil {
+		return err
+	}
+	configDesc.MediaType = MediaTypeOCIConfig
+
+	manifestBytes, err := json.Marshal(&Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        *configDesc,
+		Layers:        layerDescs,
+	})
+	if err != nil {
+		return fmt.Errorf("oci manifest marshal error, %v", err)
+	}
+	manifestDesc, err := writeOCIBlobBytes(layoutDir, manifestBytes)
+	if err != nil {
+		return err
+	}
+	manifestDesc.MediaType = MediaTypeOCIManifest
+	if ref, err := ParseReference(imageRef); err == nil && ref.Digest == "" {
+		manifestDesc.Annotations = map[string]string{OCIRefNameAnnotation: ref.String()}
+	}
+
+	index := &Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIIndex,
+		Manifests:     []Descriptor{*manifestDesc},
+	}
+	if err = writeJSONFile(path.Join(layoutDir, OCIIndexFileName), index); err != nil {
+		return fmt.Errorf("oci index write error, %v", err)
+	}
+
+	return writeJSONFile(path.Join(layoutDir, OCILayoutFileName), &ociLayout{ImageLayoutVersion: OCILayoutVersion})
+}
+
+// 构造OCI镜像config, 保留镜像原有config, 并将rootfs替换为重新打包后的diff ids
+func buildOCIConfig(img *Image, diffIds []string) ([]byte, error) {
+	imageConfig := make(map[string]interface{})
+	content, err := img.GetRawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &imageConfig); err != nil {
+		return nil, fmt.Errorf("image config unmarshal error, %v", err)
+	}
+
+	if _, exist := imageConfig["architecture"]; !exist {
+		imageConfig["architecture"] = runtime.GOARCH
+	}
+	if _, exist := imageConfig["os"]; !exist {
+		imageConfig["os"] = runtime.GOOS
+	}
+	imageConfig["rootfs"] = map[string]interface{}{
+		"type":     "layers",
+		"diff_ids": diffIds,
+	}
+
+	return json.Marshal(imageConfig)
+}
+
+// 将数据写入blob文件, 文件名为内容的digest
+func writeOCIBlob(layoutDir string, writeFunc func(writer io.Writer) error) (*Descriptor, error) {
+	blobDir := path.Join(layoutDir, OCIBlobsDirName, DigestAlgorithm)
+	tmpFile, err := os.CreateTemp(blobDir, "tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("blob tmp file create error, %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	if err = writeFunc(io.MultiWriter(tmpFile, hash)); err != nil {
+		return nil, err
+	}
+	stat, err := tmpFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	hexStr := hex.EncodeToString(hash.Sum(nil))
+	if err = os.Rename(tmpFile.Name(), path.Join(blobDir, hexStr)); err != nil {
+		return nil, fmt.Errorf("blob rename error, %v", err)
+	}
+
+	return &Descriptor{Digest: DigestAlgorithm + ":" + hexStr, Size: stat.Size()}, nil
+}
+
+// 将内存中的数据写入blob文件
+func writeOCIBlobBytes(layoutDir string, content []byte) (*Descriptor, error) {
+	return writeOCIBlob(layoutDir, func(writer io.Writer) error {
+		_, err := writer.Write(content)
+		return err
+	})
+}
+
+// endregion
+
+// 获取blob文件路径: blobs/{algorithm}/{hex}
+func getOCIBlobPath(layoutDir, digest string) string {
+	algorithm, hexStr := splitDigest(digest)
+
+	return getArchiveFilePath(layoutDir, path.Join(OCIBlobsDirName, algorithm, hexStr))
+}
+
+// 读取json文件并反序列化
+func readJSONFile(filePath string, v interface{}) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// 将对象序列化后写入json文件
+func writeJSONFile(filePath string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, content, 0644)
+}
@@ -0,0 +1,124 @@
+package image
+
+import "time"
+
+// Image 镜像元信息, 记录镜像由哪些layer组成, 镜像名通过引用(name:tag)指向镜像id
+type Image struct {
+	Id          string   `json:"id"`     // 镜像config的sha256 digest
+	Layers      []string `json:"layers"` // layer digest列表, 由最底层到最顶层排列
+	CreatedTime string   `json:"createTime"`
+}
+
+// ImageConfig 镜像config, 兼容docker/OCI镜像config格式, 这里只解析运行容器需要的字段
+type ImageConfig struct {
+	Architecture string          `json:"architecture,omitempty"`
+	OS           string          `json:"os,omitempty"`
+	Config       ContainerConfig `json:"config"`
+}
+
+// 镜像config中的rootfs信息, 用于校验layer的diff id
+type imageRootFS struct {
+	RootFS struct {
+		DiffIds []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ContainerConfig 镜像中定义的容器默认运行参数
+type ContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+}
+
+const (
+	ImageManifestName = "manifest.json"
+	ImageConfigName   = "config.json"
+	LayerDiffDirName  = "diff"
+	LayerRemapDirName = "remap"
+	// layer导入时记录的文件校验信息
+	LayerIntegrityName = "integrity.json"
+
+	// docker save导出包中的manifest文件
+	DockerArchiveManifestName = "manifest.json"
+
+	// layer digest使用的hash算法
+	DigestAlgorithm = "sha256"
+
+	// 镜像引用未指定tag时使用的默认tag
+	DefaultTag = "latest"
+)
+
+// OCI/Docker registry 通用的内容描述符
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// Platform 镜像适用的平台
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Index OCI image index(index.json)/docker manifest list
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest OCI image manifest/docker manifest v2 schema 2
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// OCI image layout 相关常量
+const (
+	OCILayoutFileName    = "oci-layout"
+	OCIIndexFileName     = "index.json"
+	OCIBlobsDirName      = "blobs"
+	OCILayoutVersion     = "1.0.0"
+	OCIRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// Docker registry 相关常量
+const (
+	// 未指定registry地址时使用Docker Hub
+	DefaultRegistryDomain = "docker.io"
+	DefaultRegistryHost   = "registry-1.docker.io"
+	// Docker Hub官方镜像所在的namespace
+	OfficialRepositoryPrefix = "library/"
+
+	// 访问registry的超时时间, 只限制建立连接和等待响应, 不限制layer下载的总时间
+	registryDialTimeout           = 30 * time.Second
+	registryTLSHandshakeTimeout   = 10 * time.Second
+	registryResponseHeaderTimeout = 60 * time.Second
+
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerConfig       = "application/vnd.docker.container.image.v1+json"
+	MediaTypeDockerLayerGzip    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// RegistryOptions 访问registry时使用的参数
+type RegistryOptions struct {
+	Insecure bool // 使用http访问registry
+	Username string
+	Password string
+}
@@ -0,0 +1,186 @@
+package image
+
+import (
+	"docker/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// 仓库名的单个路径组成部分, 第一部分可以为带端口的registry地址
+	nameComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	domainRegexp        = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[.-][a-zA-Z0-9]+)*(?::[0-9]+)?$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference 镜像引用, 格式为 name:tag 或 name@sha256:...
+type Reference struct {
+	Name   string
+	Tag    string
+	Digest string
+}
+
+// ParseReference 解析镜像引用, 未指定tag和digest时默认使用latest
+func ParseReference(refStr string) (*Reference, error) {
+	ref := &Reference{Name: refStr}
+	if idx := strings.Index(ref.Name, "@"); idx >= 0 {
+		ref.Name, ref.Digest = ref.Name[:idx], ref.Name[idx+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("invalid reference %s, invalid digest", refStr)
+		}
+	}
+	// 最后一个 "/" 之后的 ":" 为tag分隔符, 之前的为registry端口
+	if idx := strings.LastIndex(ref.Name, ":"); idx > strings.LastIndex(ref.Name, "/") {
+		ref.Name, ref.Tag = ref.Name[:idx], ref.Name[idx+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("invalid reference %s, invalid tag", refStr)
+		}
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+
+	components := strings.Split(ref.Name, "/")
+	for i, component := range components {
+		if i == 0 && len(components) > 1 && domainRegexp.MatchString(component) {
+			continue
+		}
+		if !nameComponentRegexp.MatchString(component) {
+			return nil, fmt.Errorf("invalid reference %s, invalid name", refStr)
+		}
+	}
+
+	return ref, nil
+}
+
+// String 镜像引用的规范化字符串, 指定digest时使用 name@digest, 否则使用 name:tag
+func (ref *Reference) String() string {
+	if ref.Digest != "" {
+		return ref.Name + "@" + ref.Digest
+	}
+
+	return ref.Name + ":" + ref.Tag
+}
+
+// AddReference 将镜像引用指向指定镜像, 引用已存在时指向新的镜像
+func AddReference(refStr, imageId string) error {
+	ref, err := ParseReference(refStr)
+	if err != nil {
+		return err
+	}
+	imageExists, err := IsImageExists(imageId)
+	if err != nil {
+		return err
+	}
+	if !imageExists {
+		return fmt.Errorf("image %s not exists", imageId)
+	}
+
+	references, err := loadReferences()
+	if err != nil {
+		return err
+	}
+	references[ref.String()] = imageId
+
+	return dumpReferences(references)
+}
+
+// RemoveReference 删除镜像引用, 返回引用原来指向的镜像id
+func RemoveReference(refStr string) (string, error) {
+	ref, err := ParseReference(refStr)
+	if err != nil {
+		return "", err
+	}
+
+	references, err := loadReferences()
+	if err != nil {
+		return "", err
+	}
+	imageId, exist := references[ref.String()]
+	if !exist {
+		return "", fmt.Errorf("reference %s not exists", refStr)
+	}
+	delete(references, ref.String())
+
+	return imageId, dumpReferences(references)
+}
+
+// GetImageReferences 获取指向指定镜像的所有引用
+func GetImageReferences(imageId string) ([]string, error) {
+	references, err := loadReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for ref, id := range references {
+		if id == imageId {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+
+	return refs, nil
+}
+
+// 查询引用指向的镜像id
+func lookupReference(ref *Reference) (string, bool) {
+	references, err := loadReferences()
+	if err != nil {
+		return "", false
+	}
+	imageId, exist := references[ref.String()]
+
+	return imageId, exist
+}
+
+// 删除指向指定镜像的所有引用
+func removeImageReferences(imageId string) error {
+	references, err := loadReferences()
+	if err != nil {
+		return err
+	}
+	for ref, id := range references {
+		if id == imageId {
+			delete(references, ref)
+		}
+	}
+
+	return dumpReferences(references)
+}
+
+// 从引用存储文件中读取所有引用, key为规范化的引用, value为镜像id
+func loadReferences() (map[string]string, error) {
+	references := make(map[string]string)
+	content, err := os.ReadFile(config.PathImageRepositories)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return references, nil
+		}
+		return nil, fmt.Errorf("image references read error, %v", err)
+	}
+
+	if err = json.Unmarshal(content, &references); err != nil {
+		return nil, fmt.Errorf("image references unmarshal error, %v", err)
+	}
+
+	return references, nil
+}
+
+// 将所有引用写入引用存储文件
+func dumpReferences(references map[string]string) error {
+	if err := os.MkdirAll(path.Dir(config.PathImageRepositories), 0755); err != nil {
+		return fmt.Errorf("image references dir create error, %v", err)
+	}
+	if err := writeJSONFile(config.PathImageRepositories, references); err != nil {
+		return fmt.Errorf("image references write error, %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package image
+
+import (
+	"bytes"
+	"docker/config"
+	"docker/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// region 拉取镜像
+
+// PullImage 从registry拉取镜像, layer导入layer store, 本地已存在的layer直接跳过
+// 拉取完成后创建 name:tag 和 name@manifest-digest 两个镜像引用, manifest list/index使用其自身的digest, 与docker一致
+func PullImage(refStr string, options *RegistryOptions) (*Image, error) {
+	ref, err := ParseReference(refStr)
+	if err != nil {
+		return nil, err
+	}
+	client := newRegistryClient(ref, options)
+
+	manifestRef := ref.Tag
+	if ref.Digest != "" {
+		manifestRef = ref.Digest
+	}
+	manifest, manifestDigest, resolvedDigest, err := fetchManifest(client, manifestRef)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" && ref.Digest != manifestDigest {
+		return nil, fmt.Errorf("manifest digest mismatch, expect %s, got %s", ref.Digest, manifestDigest)
+	}
+
+	var configBuffer bytes.Buffer
+	if err = client.getBlob(manifest.Config.Digest, &configBuffer); err != nil {
+		return nil, fmt.Errorf("image config download error, %v", err)
+	}
+	configBytes := configBuffer.Bytes()
+	rootFS := &imageRootFS{}
+	if err = json.Unmarshal(configBytes, rootFS); err != nil {
+		return nil, fmt.Errorf("image config unmarshal error, %v", err)
+	}
+	diffIds := rootFS.RootFS.DiffIds
+	if len(diffIds) != len(manifest.Layers) {
+		return nil, fmt.Errorf("image config has %d diff ids, manifest has %d layers", len(diffIds), len(manifest.Layers))
+	}
+
+	layers := make([]string, 0, len(manifest.Layers))
+	for i, layerDesc := range manifest.Layers {
+		layerExists, err := IsLayerExists(diffIds[i])
+		if err != nil {
+			return nil, err
+		}
+		if layerExists {
+			if err = VerifyLayer(diffIds[i]); err != nil {
+				return nil, fmt.Errorf("existing layer is corrupted, %v", err)
+			}
+			utils.LoggerUtil.Infof("layer %s already exists", layerDesc.Digest)
+			layers = append(layers, diffIds[i])
+			continue
+		}
+
+		utils.LoggerUtil.Infof("pulling layer %s", layerDesc.Digest)
+		digest, err := pullLayer(client, layerDesc)
+		if err != nil {
+			return nil, fmt.Errorf("pull layer %s error, %v", layerDesc.Digest, err)
+		}
+		if digest != diffIds[i] {
+			return nil, fmt.Errorf("layer diff id mismatch, expect %s, got %s", diffIds[i], digest)
+		}
+		layers = append(layers, digest)
+	}
+
+	img, err := CreateImage(layers, configBytes)
+	if err != nil {
+		return nil, err
+	}
+	// 按digest拉取时只保存用户指定的digest引用
+	if ref.Digest == "" {
+		if err = AddReference(ref.String(), img.Id); err != nil {
+			return nil, err
+		}
+		ref.Digest = manifestDigest
+	}
+	if err = AddReference(ref.String(), img.Id); err != nil {
+		return nil, err
+	}
+	utils.LoggerUtil.Infof("pulled image %s, digest %s, platform manifest %s", img.Id, manifestDigest, resolvedDigest)
+
+	return img, nil
+}
+
+// 获取镜像manifest, manifest list/index按当前平台选择manifest
+// 返回选择的manifest, 请求获取的manifest(可能为manifest list/index)的digest, 以及选择的manifest的digest
+func fetchManifest(client *registryClient, reference string) (*Manifest, string, string, error) {
+	content, mediaType, digest, err := client.getManifest(reference)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	switch mediaType {
+	case MediaTypeOCIManifest, MediaTypeDockerManifest:
+		manifest := &Manifest{}
+		if err = json.Unmarshal(content, manifest); err != nil {
+			return nil, "", "", fmt.Errorf("manifest unmarshal error, %v", err)
+		}
+		return manifest, digest, digest, nil
+	case MediaTypeOCIIndex, MediaTypeDockerManifestList:
+		index := &Index{}
+		if err = json.Unmarshal(content, index); err != nil {
+			return nil, "", "", fmt.Errorf("manifest list unmarshal error, %v", err)
+		}
+		for _, desc := range index.Manifests {
+			if desc.Platform == nil || !isCurrentPlatform(desc.Platform) {
+				continue
+			}
+			manifest, childDigest, resolvedDigest, err := fetchManifest(client, desc.Digest)
+			if err != nil {
+				return nil, "", "", err
+			}
+			if childDigest != desc.Digest {
+				return nil, "", "", fmt.Errorf("manifest digest mismatch, expect %s, got %s", desc.Digest, childDigest)
+			}
+			return manifest, digest, resolvedDigest, nil
+		}
+		return nil, "", "", fmt.Errorf("no manifest found for current platform")
+	default:
+		return nil, "", "", fmt.Errorf("unsupported manifest media type %s", mediaType)
+	}
+}
+
+// 下载layer blob到临时文件, 校验digest后导入layer store, 返回layer的diff id
+func pullLayer(client *registryClient, desc Descriptor) (string, error) {
+	switch desc.MediaType {
+	case MediaTypeOCILayer, MediaTypeOCILayerGzip, MediaTypeDockerLayerGzip:
+	default:
+		return "", fmt.Errorf("unsupported layer media type %s", desc.MediaType)
+	}
+
+	if err := os.MkdirAll(config.PathLayer, 0755); err != nil {
+		return "", fmt.Errorf("layer store mkdir error, %v", err)
+	}
+	blobFile, err := os.CreateTemp(config.PathLayer, "blob-")
+	if err != nil {
+		return "", fmt.Errorf("blob tmp file create error, %v", err)
+	}
+	defer os.Remove(blobFile.Name())
+	defer blobFile.Close()
+
+	if err = client.getBlob(desc.Digest, blobFile); err != nil {
+		return "", err
+	}
+
+	return ImportLayer(blobFile.Name())
+}
+
+// endregion
+
+// region 推送镜像
+
+// PushImage 将镜像推送到registry, 以OCI manifest格式上传, registry中已存在的blob直接跳过
+func PushImage(refStr string, options *RegistryOptions) error {
+	ref, err := ParseReference(refStr)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("push by digest is not supported, use name:tag")
+	}
+
+	// 先导出为OCI image layout, 再上传其中的blob和manifest
+	layoutDir, err := os.MkdirTemp("", "mdocker-push-")
+	if err != nil {
+		return fmt.Errorf("tmp dir create error, %v", err)
+	}
+	defer os.RemoveAll(layoutDir)
+	if err = SaveOCILayout(ref.String(), layoutDir); err != nil {
+		return err
+	}
+
+	index := &Index{}
+	if err = readJSONFile(path.Join(layoutDir, OCIIndexFileName), index); err != nil {
+		return fmt.Errorf("oci index read error, %v", err)
+	}
+	manifestDesc := index.Manifests[0]
+	manifestBytes, err := readOCIBlob(layoutDir, manifestDesc)
+	if err != nil {
+		return err
+	}
+	manifest := &Manifest{}
+	if err = json.Unmarshal(manifestBytes, manifest); err != nil {
+		return fmt.Errorf("oci manifest unmarshal error, %v", err)
+	}
+
+	client := newRegistryClient(ref, options)
+	for _, desc := range append(manifest.Layers, manifest.Config) {
+		blobExists, err := client.isBlobExists(desc.Digest)
+		if err != nil {
+			return err
+		}
+		if blobExists {
+			utils.LoggerUtil.Infof("blob %s already exists", desc.Digest)
+			continue
+		}
+
+		utils.LoggerUtil.Infof("pushing blob %s", desc.Digest)
+		if err = client.uploadBlob(getOCIBlobPath(layoutDir, desc.Digest), desc); err != nil {
+			return fmt.Errorf("push blob %s error, %v", desc.Digest, err)
+		}
+	}
+
+	if err = client.putManifest(ref.Tag, manifestDesc.MediaType, manifestBytes); err != nil {
+		return fmt.Errorf("push manifest error, %v", err)
+	}
+	utils.LoggerUtil.Infof("pushed %s, digest %s", ref, manifestDesc.Digest)
+
+	return nil
+}
+
+// endregion
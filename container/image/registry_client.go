@@ -0,0 +1,359 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// registry返回的WWW-Authenticate中的参数, 如 realm="https://auth.docker.io/token"
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// 访问registry v2 API的客户端, 一个客户端只访问一个仓库
+type registryClient struct {
+	baseUrl       string // scheme://host
+	repository    string // 仓库在registry中的路径, 如 library/alpine
+	options       *RegistryOptions
+	httpClient    *http.Client
+	authorization string // 认证后使用的Authorization header
+}
+
+// 根据镜像引用创建registry客户端
+func newRegistryClient(ref *Reference, options *RegistryOptions) *registryClient {
+	if options == nil {
+		options = &RegistryOptions{}
+	}
+	host, repository := splitRepository(ref.Name)
+	scheme := "https"
+	if options.Insecure {
+		scheme = "http"
+	}
+
+	return &registryClient{
+		baseUrl:    scheme + "://" + host,
+		repository: repository,
+		options:    options,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: registryDialTimeout}).DialContext,
+				TLSHandshakeTimeout:   registryTLSHandshakeTimeout,
+				ResponseHeaderTimeout: registryResponseHeaderTimeout,
+			},
+		},
+	}
+}
+
+// 拆分镜像名中的registry地址和仓库路径
+// 第一部分包含 "." 或 ":" 或为localhost时视为registry地址, 否则使用Docker Hub
+func splitRepository(name string) (string, string) {
+	domain, repository := DefaultRegistryDomain, name
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		domain, repository = parts[0], parts[1]
+	}
+
+	if domain != DefaultRegistryDomain {
+		return domain, repository
+	}
+	if !strings.Contains(repository, "/") {
+		repository = OfficialRepositoryPrefix + repository
+	}
+
+	return DefaultRegistryHost, repository
+}
+
+// 获取manifest原始内容, 返回内容、media type以及digest
+func (c *registryClient) getManifest(reference string) ([]byte, string, string, error) {
+	resp, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, c.getUrl("manifests", reference), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join([]string{
+			MediaTypeOCIManifest, MediaTypeOCIIndex, MediaTypeDockerManifest, MediaTypeDockerManifestList,
+		}, ", "))
+		return req, nil
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return nil, "", "", err
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("manifest read error, %v", err)
+	}
+	hash := sha256.Sum256(content)
+	digest := DigestAlgorithm + ":" + hex.EncodeToString(hash[:])
+	if headerDigest := resp.Header.Get("Docker-Content-Digest"); headerDigest != "" && headerDigest != digest {
+		return nil, "", "", fmt.Errorf("manifest digest mismatch, expect %s, got %s", headerDigest, digest)
+	}
+
+	// Content-Type缺失时使用manifest中的mediaType字段
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if mediaType == "" || mediaType == "application/json" {
+		manifest := &Manifest{}
+		if err = json.Unmarshal(content, manifest); err == nil {
+			mediaType = manifest.MediaType
+		}
+	}
+
+	return content, mediaType, digest, nil
+}
+
+// 上传manifest
+func (c *registryClient) putManifest(reference, mediaType string, content []byte) error {
+	resp, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, c.getUrl("manifests", reference), bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// 下载blob写入writer, 下载过程中计算digest并与期望的digest比较
+func (c *registryClient) getBlob(digest string, writer io.Writer) error {
+	resp, err := c.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, c.getUrl("blobs", digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(writer, hash), resp.Body); err != nil {
+		return fmt.Errorf("blob download error, %v", err)
+	}
+	if actual := DigestAlgorithm + ":" + hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return fmt.Errorf("blob digest mismatch, expect %s, got %s", digest, actual)
+	}
+
+	return nil
+}
+
+// 判断registry中是否已存在blob
+func (c *registryClient) isBlobExists(digest string) (bool, error) {
+	resp, err := c.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, c.getUrl("blobs", digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// 使用单次PUT上传blob文件
+func (c *registryClient) uploadBlob(blobPath string, desc Descriptor) error {
+	resp, err := c.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, c.getUrl("blobs", "uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err = checkResponse(resp, http.StatusAccepted); err != nil {
+		return err
+	}
+
+	// Location可能为相对路径, 并且可能已带有查询参数
+	base, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return err
+	}
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location, %v", err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do(func() (*http.Request, error) {
+		file, err := os.Open(blobPath)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPut, location.String(), file)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		req.ContentLength = desc.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// 发送请求, 收到401时根据WWW-Authenticate完成认证后重新发送
+// newRequest每次调用都需要创建新的请求, 以便重新发送请求体
+func (c *registryClient) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	resp, err := c.send(newRequest)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err = c.authorize(challenge); err != nil {
+		return nil, err
+	}
+
+	return c.send(newRequest)
+}
+
+// 创建请求并附加认证信息后发送
+func (c *registryClient) send(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, fmt.Errorf("registry request create error, %v", err)
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request error, %v", err)
+	}
+
+	return resp, nil
+}
+
+// 根据WWW-Authenticate完成认证, 支持Basic认证和Bearer token认证
+func (c *registryClient) authorize(challenge string) error {
+	parts := strings.SplitN(challenge, " ", 2)
+	scheme := strings.ToLower(parts[0])
+	params := make(map[string]string)
+	if len(parts) == 2 {
+		for _, match := range challengeParamRegexp.FindAllStringSubmatch(parts[1], -1) {
+			params[strings.ToLower(match[1])] = match[2]
+		}
+	}
+
+	switch scheme {
+	case "basic":
+		if c.options.Username == "" {
+			return fmt.Errorf("registry requires authentication, missing username")
+		}
+		credential := base64.StdEncoding.EncodeToString([]byte(c.options.Username + ":" + c.options.Password))
+		c.authorization = "Basic " + credential
+	case "bearer":
+		token, err := c.fetchToken(params["realm"], params["service"], params["scope"])
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+
+	return nil
+}
+
+// 从token服务获取Bearer token, 配置了用户名时使用Basic认证获取token
+func (c *registryClient) fetchToken(realm, service, scope string) (string, error) {
+	if realm == "" {
+		return "", fmt.Errorf("registry auth challenge missing realm")
+	}
+	tokenUrl, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid auth realm %s, %v", realm, err)
+	}
+	query := tokenUrl.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	tokenUrl.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenUrl.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.options.Username != "" {
+		req.SetBasicAuth(c.options.Username, c.options.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("registry token request error, %v", err)
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	tokenResp := &struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(tokenResp); err != nil {
+		return "", fmt.Errorf("registry token decode error, %v", err)
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	if tokenResp.AccessToken != "" {
+		return tokenResp.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("registry token response contains no token")
+}
+
+// 获取registry v2 API地址: {baseUrl}/v2/{repository}/{kind}/{reference}
+func (c *registryClient) getUrl(kind, reference string) string {
+	return fmt.Sprintf("%s/v2/%s/%s/%s", c.baseUrl, c.repository, kind, reference)
+}
+
+// 检查响应状态码, 不符合预期时返回包含响应内容的错误
+func checkResponse(resp *http.Response, expectStatus int) error {
+	if resp.StatusCode == expectStatus {
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("registry response %s, %s", resp.Status, strings.TrimSpace(string(content)))
+}
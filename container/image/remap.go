@@ -0,0 +1,132 @@
+package image
+
+import (
+	"crypto/sha256"
+	"docker/utils"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// GetRemappedLayerLowerDirs 获取按uid/gid映射修改属主后的layer目录, 作为user namespace容器的overlay lowerdir
+// 修改属主后的layer按完整的映射保存在原layer目录下, 不存在时从原layer复制生成, lowerDirs由最顶层到最底层排列
+func GetRemappedLayerLowerDirs(layers []string, uidMaps, gidMaps []syscall.SysProcIDMap) ([]string, error) {
+	if _, err := MapIdToHost(0, uidMaps); err != nil {
+		return nil, err
+	}
+	if _, err := MapIdToHost(0, gidMaps); err != nil {
+		return nil, err
+	}
+	mapsKey := getIdMapsKey(uidMaps, gidMaps)
+
+	lowerDirs := make([]string, 0, len(layers))
+	for i := len(layers) - 1; i >= 0; i-- {
+		layerExists, err := IsLayerExists(layers[i])
+		if err != nil {
+			return nil, err
+		}
+		if !layerExists {
+			return nil, fmt.Errorf("layer %s missing", layers[i])
+		}
+
+		remapPath := path.Join(getLayerPath(layers[i]), LayerRemapDirName, mapsKey)
+		if err = createRemappedLayer(GetLayerDiffPath(layers[i]), remapPath, uidMaps, gidMaps); err != nil {
+			return nil, fmt.Errorf("layer %s remap error, %v", layers[i], err)
+		}
+		lowerDirs = append(lowerDirs, remapPath)
+	}
+
+	return lowerDirs, nil
+}
+
+// 计算uid/gid映射的key, 起始id相同但范围不同的映射生成的layer属主不同, 需要区分保存
+func getIdMapsKey(uidMaps, gidMaps []syscall.SysProcIDMap) string {
+	hash := sha256.New()
+	for _, idMap := range uidMaps {
+		_, _ = fmt.Fprintf(hash, "u:%d:%d:%d\n", idMap.ContainerID, idMap.HostID, idMap.Size)
+	}
+	for _, idMap := range gidMaps {
+		_, _ = fmt.Fprintf(hash, "g:%d:%d:%d\n", idMap.ContainerID, idMap.HostID, idMap.Size)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// MapIdToHost 将容器内的uid/gid按映射转换为宿主机上的id
+func MapIdToHost(containerId int, idMaps []syscall.SysProcIDMap) (int, error) {
+	for _, idMap := range idMaps {
+		if containerId >= idMap.ContainerID && containerId < idMap.ContainerID+idMap.Size {
+			return idMap.HostID + containerId - idMap.ContainerID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("id %d is not mapped", containerId)
+}
+
+// 复制layer目录并修改所有文件的属主, 先复制到临时目录, 完成后再重命名, 已存在时直接使用
+func createRemappedLayer(diffPath, remapPath string, uidMaps, gidMaps []syscall.SysProcIDMap) error {
+	remapExists, err := utils.GeneralUtils.IsDirExists(remapPath)
+	if err != nil || remapExists {
+		return err
+	}
+
+	if err = os.MkdirAll(path.Dir(remapPath), 0755); err != nil {
+		return err
+	}
+	tmpPath, err := os.MkdirTemp(path.Dir(remapPath), "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	// cp -a 保留whiteout设备文件, 硬链接和overlay xattr
+	copyPath := path.Join(tmpPath, LayerDiffDirName)
+	if output, err := exec.Command("cp", "-a", diffPath, copyPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("layer copy error, %v, %s", err, output)
+	}
+	// 硬链接指向的inode会被遍历多次, 每个inode只修改一次属主, 避免重复映射
+	visited := make(map[[2]uint64]bool)
+	err = filepath.Walk(copyPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if stat.Nlink > 1 && !info.IsDir() {
+			inode := [2]uint64{uint64(stat.Dev), uint64(stat.Ino)}
+			if visited[inode] {
+				return nil
+			}
+			visited[inode] = true
+		}
+		// 未映射的id保持不变, 在容器内显示为overflow id
+		uid, uidErr := MapIdToHost(int(stat.Uid), uidMaps)
+		gid, gidErr := MapIdToHost(int(stat.Gid), gidMaps)
+		if uidErr != nil {
+			uid = int(stat.Uid)
+		}
+		if gidErr != nil {
+			gid = int(stat.Gid)
+		}
+		if err = os.Lchown(filePath, uid, gid); err != nil {
+			return err
+		}
+		// chown会清除setuid/setgid位, 需要重新设置
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && info.Mode()&os.ModeSymlink == 0 {
+			return os.Chmod(filePath, info.Mode())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("layer chown error, %v", err)
+	}
+
+	return os.Rename(copyPath, remapPath)
+}
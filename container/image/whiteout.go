@@ -0,0 +1,88 @@
+package image
+
+import (
+	"docker/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// AUFS/OCI格式的whiteout标记
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	// overlayfs的opaque目录标记, rootless模式下overlay以userxattr方式挂载, 使用user命名空间的xattr
+	overlayOpaqueXattr         = "trusted.overlay.opaque"
+	overlayRootlessOpaqueXattr = "user.overlay.opaque"
+)
+
+// 将layer目录中AUFS风格的whiteout标记转换为overlayfs whiteout:
+//  1. .wh..wh..opq 转换为父目录上的 trusted.overlay.opaque=y xattr, rootless模式下为 user.overlay.opaque
+//  2. .wh.{name} 转换为名为{name}的 0/0 字符设备
+func convertWhiteoutsToOverlay(diffPath string) error {
+	// 先收集所有标记文件, 避免遍历过程中修改目录
+	var markers []string
+	err := filepath.Walk(diffPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), whiteoutPrefix) {
+			markers = append(markers, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk layer dir error, %v", err)
+	}
+
+	for _, marker := range markers {
+		dir, name := filepath.Split(marker)
+		if err = os.Remove(marker); err != nil {
+			return fmt.Errorf("remove whiteout marker %s error, %v", marker, err)
+		}
+
+		if name == whiteoutOpaque {
+			if err = syscall.Setxattr(dir, getOverlayOpaqueXattr(), []byte("y"), 0); err != nil {
+				return fmt.Errorf("set opaque xattr on %s error, %v", dir, err)
+			}
+			continue
+		}
+
+		target := filepath.Join(dir, strings.TrimPrefix(name, whiteoutPrefix))
+		if err = syscall.Mknod(target, syscall.S_IFCHR|0000, 0); err != nil {
+			return fmt.Errorf("create whiteout %s error, %v", target, err)
+		}
+	}
+
+	return nil
+}
+
+// 判断文件是否为overlayfs whiteout, 即 0/0 字符设备
+func isOverlayWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	return ok && stat.Rdev == 0
+}
+
+// 判断目录是否被标记为overlayfs opaque目录
+func isOverlayOpaque(dirPath string) bool {
+	value := make([]byte, 1)
+	n, err := syscall.Getxattr(dirPath, getOverlayOpaqueXattr(), value)
+
+	return err == nil && n == 1 && value[0] == 'y'
+}
+
+// 获取当前模式下overlayfs使用的opaque xattr名称
+func getOverlayOpaqueXattr() string {
+	if config.Rootless {
+		return overlayRootlessOpaqueXattr
+	}
+
+	return overlayOpaqueXattr
+}
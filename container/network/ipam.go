@@ -49,7 +49,7 @@ func (ipam *IpAddressManager) dump() error {
 			return err
 		}
 		// 创建path
-		err = os.MkdirAll(ipamConfigFileDir, 0644)
+		err = os.MkdirAll(ipamConfigFileDir, 0755)
 		if err != nil {
 			return err
 		}
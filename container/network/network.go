@@ -20,7 +20,7 @@ type Network struct {
 func (nw *Network) dump(dumpPath string) error {
 	if _, err := os.Stat(dumpPath); err != nil {
 		if os.IsNotExist(err) {
-			os.MkdirAll(dumpPath, 0644)
+			os.MkdirAll(dumpPath, 0755)
 		} else {
 			return err
 		}
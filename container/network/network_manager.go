@@ -42,7 +42,7 @@ func init() {
 			return
 		}
 
-		if err = os.MkdirAll(DefaultNetworkPath, 0644); err != nil {
+		if err = os.MkdirAll(DefaultNetworkPath, 0755); err != nil {
 			return
 		}
 	}
@@ -277,6 +277,11 @@ func (n *networkManager) configPortMapping(ep *Endpoint) error {
 
 // 将container从network中断开, 并清理container网络环境设置
 func (n *networkManager) DisConnect(cInfo *container_info.ContainerInfo) error {
+	// 未加入网络的容器无需清理
+	if cInfo.IpAddr == "" {
+		return nil
+	}
+
 	// 解析cidr地址
 	ip, ipNet, err := net.ParseCIDR(cInfo.IpAddr)
 	if err != nil {
@@ -1,9 +1,11 @@
 package network
 
 import (
+	"docker/config"
 	"fmt"
 	"github.com/vishvananda/netlink"
 	"net"
+	"path"
 	"time"
 )
 
@@ -26,11 +28,13 @@ type NetworkDriver interface {
 	Disconnect(network Network, endpoint *Endpoint) error
 }
 
-const (
+var (
 	// 子网ip地址配置文件path
-	IpAddrConfigFilePath = "/var/run/mdocker/network/ipam/subnet.json"
-	DefaultNetworkPath   = "/var/run/mdocker/network/instances/"
+	IpAddrConfigFilePath = path.Join(config.PathRunRoot, "network/ipam/subnet.json")
+	DefaultNetworkPath   = path.Join(config.PathRunRoot, "network/instances")
+)
 
+const (
 	// 驱动名字
 	DriverNameBridge = "bridge"
 )
@@ -9,8 +9,91 @@ package nsenter
 #include <string.h>
 #include <fcntl.h>
 #include <unistd.h>
+#include <signal.h>
+#include <grp.h>
+#include <poll.h>
+#include <sys/stat.h>
+#include <sys/wait.h>
+
+static pid_t exec_child_pid;
+
+// 判断当前进程与目标进程是否处于同一namespace, 容器可以与宿主机共享部分namespace
+static int is_same_namespace(char *pid, char *ns) {
+	char nspath[1024];
+	struct stat self_stat, target_stat;
+
+	sprintf(nspath, "/proc/self/ns/%s", ns);
+	if (stat(nspath, &self_stat) == -1) {
+		return 0;
+	}
+	sprintf(nspath, "/proc/%s/ns/%s", pid, ns);
+	if (stat(nspath, &target_stat) == -1) {
+		return 0;
+	}
+
+	return self_stat.st_ino == target_stat.st_ino && self_stat.st_dev == target_stat.st_dev;
+}
+
+// 容器使用了独立的user namespace时, 需要先加入该namespace才有权限加入其余namespace
+// 加入后切换为容器内的root, 与容器init进程的身份保持一致
+static void enter_user_namespace(char *pid) {
+	char nspath[1024];
+
+	if (is_same_namespace(pid, "user")) {
+		return;
+	}
+
+	// 加入失败时不能继续以宿主机root身份加入其余namespace
+	sprintf(nspath, "/proc/%s/ns/user", pid);
+	int fd = open(nspath, O_RDONLY);
+	if (fd == -1) {
+		fprintf(stderr, "open %s failed: %s\n", nspath, strerror(errno));
+		exit(1);
+	}
+	if (setns(fd, CLONE_NEWUSER) == -1) {
+		fprintf(stderr, "setns on user namespace failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	close(fd);
+	fprintf(stdout, "setns on user namespace succeeded\n");
+
+	// rootless模式下user namespace禁用了setgroups, 保留原有的附加用户组
+	if ((setgroups(0, NULL) == -1 && errno != EPERM) || setresgid(0, 0, 0) == -1 || setresuid(0, 0, 0) == -1) {
+		fprintf(stderr, "switch to user namespace root failed: %s\n", strerror(errno));
+		exit(1);
+	}
+}
+
+// 容器init进程在go runtime启动前创建cgroup namespace, 使namespace对进程的所有线程生效
+// 父进程在将init进程加入容器cgroup之后才写入init配置, 配置pipe可读时容器cgroup即成为namespace的根
+static void unshare_cgroup_namespace(void) {
+	if (!getenv("mdocker_cgroupns")) {
+		return;
+	}
+
+	struct pollfd pfd = { .fd = 3, .events = POLLIN };
+	while (poll(&pfd, 1, -1) == -1) {
+		if (errno != EINTR) {
+			fprintf(stderr, "wait for init config failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
+	if (unshare(CLONE_NEWCGROUP) == -1) {
+		fprintf(stderr, "unshare cgroup namespace failed: %s\n", strerror(errno));
+		exit(1);
+	}
+}
+
+// 将终止信号转发给在容器中执行命令的子进程
+static void forward_signal(int sig) {
+	if (exec_child_pid > 0) {
+		kill(exec_child_pid, sig);
+	}
+}
 
 __attribute__((constructor)) void enter_namespace(void) {
+	unshare_cgroup_namespace();
+
 	char *mydocker_pid;
 	mydocker_pid = getenv("mdocker_pid");
 	if (mydocker_pid) {
@@ -20,32 +103,61 @@ __attribute__((constructor)) void enter_namespace(void) {
 		return;
 	}
 
-	char *mydocker_cmd;
-	mydocker_cmd = getenv("mdocker_cmd");
-	if (mydocker_cmd) {
-		fprintf(stdout, "got mdocker_cmd=%s\n", mydocker_cmd);
-	} else {
-		fprintf(stdout, "missing mdocker_cmd env skip nsenter\n");
-		return;
-	}
+	enter_user_namespace(mydocker_pid);
+
 	int i;
 	char nspath[1024];
-	char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+	char *namespaces[] = { "ipc", "uts", "net", "pid", "cgroup", "mnt" };
 
-	for (i=0; i<5; i++) {
+	for (i=0; i<6; i++) {
+		// cgroup namespace默认与宿主机共享, rootless模式下没有权限重复加入
+		if (is_same_namespace(mydocker_pid, namespaces[i])) {
+			continue;
+		}
 		sprintf(nspath, "/proc/%s/ns/%s", mydocker_pid, namespaces[i]);
 		int fd = open(nspath, O_RDONLY);
+		if (fd == -1) {
+			fprintf(stderr, "open %s failed: %s\n", nspath, strerror(errno));
+			exit(1);
+		}
 
+		// 只加入部分namespace时命令会在容器之外执行, 任一namespace加入失败即退出
 		if (setns(fd, 0) == -1) {
 			fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
-		} else {
-			fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
+			exit(1);
 		}
+		fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
 		close(fd);
 	}
-	int res = system(mydocker_cmd);
-	exit(0);
-	return;
+
+	// 加入的pid namespace只对子进程生效, 且go runtime无法在此状态下创建线程
+	// 因此fork出子进程继续执行go代码, 当前进程等待子进程并以其退出码退出
+	exec_child_pid = fork();
+	if (exec_child_pid == -1) {
+		fprintf(stderr, "fork failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	if (exec_child_pid == 0) {
+		return;
+	}
+
+	close(3);
+	signal(SIGTERM, forward_signal);
+	signal(SIGHUP, forward_signal);
+	// 终端产生的SIGINT/SIGQUIT会同时发送给子进程
+	signal(SIGINT, SIG_IGN);
+	signal(SIGQUIT, SIG_IGN);
+
+	int status;
+	while (waitpid(exec_child_pid, &status, 0) == -1) {
+		if (errno != EINTR) {
+			exit(1);
+		}
+	}
+	if (WIFSIGNALED(status)) {
+		exit(128 + WTERMSIG(status));
+	}
+	exit(WEXITSTATUS(status));
 }
 */
 import "C"
\ No newline at end of file
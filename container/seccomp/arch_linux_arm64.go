@@ -0,0 +1,7 @@
+package seccomp
+
+// 本机架构和兼容架构在seccomp配置中的名称
+const (
+	nativeArchName = ArchAarch64
+	compatArchName = ArchArm
+)
@@ -0,0 +1,301 @@
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// bpf指令, 条件不满足时跳转到当前规则末尾
+type instruction struct {
+	syscall.SockFilter
+	jtFail bool
+	jfFail bool
+}
+
+func stmt(code uint16, k uint32) instruction {
+	return instruction{SockFilter: syscall.SockFilter{Code: code, K: k}}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) instruction {
+	return instruction{SockFilter: syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}}
+}
+
+// 条件成立时继续执行下一条指令, 否则跳转到规则末尾
+func jumpOrFail(code uint16, k uint32) instruction {
+	return instruction{SockFilter: syscall.SockFilter{Code: code, K: k}, jfFail: true}
+}
+
+// 条件成立时跳转到规则末尾, 否则继续执行下一条指令
+func failIf(code uint16, k uint32) instruction {
+	return instruction{SockFilter: syscall.SockFilter{Code: code, K: k}, jtFail: true}
+}
+
+func loadAbs(offset uint32) instruction {
+	return stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offset)
+}
+
+func ret(value uint32) instruction {
+	return stmt(syscall.BPF_RET|syscall.BPF_K, value)
+}
+
+// 过滤规则对应的系统调用架构
+type archSyscalls struct {
+	auditArch      uint32
+	syscallNumbers map[string]uint32
+}
+
+// 将seccomp配置编译为bpf程序, caps为容器拥有的capability, 用于判断规则是否生效
+// 每个架构按各自的系统调用编号生成一段规则, 规则按配置顺序匹配, 第一个匹配的规则生效
+func compile(profile *Profile, caps []string) ([]syscall.SockFilter, error) {
+	defaultRet, err := actionRet(profile.DefaultAction, nil, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections [][]syscall.SockFilter
+	arches := getProfileArches(profile)
+	for _, arch := range arches {
+		section, err := compileArchRules(profile, caps, arch, defaultRet)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+	}
+
+	// 按系统调用架构跳转到对应的规则段, 规则段超过条件跳转的范围, 使用无条件跳转
+	// 不在配置中的架构直接结束进程, 避免通过其他ABI绕过过滤
+	headerLen := 2*len(arches) + 2
+	program := []syscall.SockFilter{loadAbs(offsetArch).SockFilter}
+	sectionOffset := headerLen
+	for i, arch := range arches {
+		program = append(program,
+			jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, arch.auditArch, 0, 1).SockFilter,
+			stmt(syscall.BPF_JMP|syscall.BPF_JA, uint32(sectionOffset-2*i-3)).SockFilter,
+		)
+		sectionOffset += len(sections[i])
+	}
+	program = append(program, ret(retKillProcess).SockFilter)
+	for _, section := range sections {
+		program = append(program, section...)
+	}
+
+	if len(program) > bpfMaxInstructions {
+		return nil, fmt.Errorf("seccomp filter has %d instructions, exceeds %d", len(program), bpfMaxInstructions)
+	}
+
+	return program, nil
+}
+
+// 获取配置中需要过滤的架构, 本机架构始终包含在内, archMap或architectures中包含兼容架构时加入兼容架构
+func getProfileArches(profile *Profile) []*archSyscalls {
+	arches := []*archSyscalls{{auditArch: nativeArch, syscallNumbers: syscallNumbers}}
+
+	names := profile.Architectures
+	for _, archMap := range profile.ArchMap {
+		if archMap.Arch == nativeArchName {
+			names = append(append([]string{}, names...), archMap.SubArches...)
+		}
+	}
+	if compatArchName != "" && containsString(names, compatArchName) {
+		arches = append(arches, &archSyscalls{auditArch: compatArch, syscallNumbers: compatSyscallNumbers})
+	}
+
+	return arches
+}
+
+// 编译单个架构的规则段, 规则都不匹配时返回默认动作
+func compileArchRules(profile *Profile, caps []string, arch *archSyscalls, defaultRet uint32) ([]syscall.SockFilter, error) {
+	var section []syscall.SockFilter
+	// x32 ABI与本机架构使用相同的架构标识, 不允许使用x32系统调用
+	if arch.auditArch == nativeArch && x32SyscallBit != 0 {
+		section = append(section,
+			loadAbs(offsetNr).SockFilter,
+			jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, 0, 1).SockFilter,
+			ret(retErrno|uint32(syscall.EPERM)).SockFilter,
+		)
+	}
+
+	for _, rule := range profile.Syscalls {
+		if !isRuleEnabled(rule, caps) {
+			continue
+		}
+		actionValue, err := actionRet(rule.Action, rule.ErrnoRet, profile.DefaultErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+
+		names := rule.Names
+		if rule.Name != "" {
+			names = append([]string{rule.Name}, names...)
+		}
+		for _, name := range names {
+			nr, exist := arch.syscallNumbers[name]
+			if !exist { // 该架构不存在的系统调用直接忽略
+				continue
+			}
+			block, err := compileRule(nr, rule.Args, actionValue)
+			if err != nil {
+				return nil, fmt.Errorf("syscall %s, %v", name, err)
+			}
+			section = append(section, block...)
+		}
+	}
+
+	return append(section, ret(defaultRet).SockFilter), nil
+}
+
+// 编译单个系统调用的规则: 系统调用号和所有参数条件都满足时返回action
+func compileRule(nr uint32, args []*Arg, actionValue uint32) ([]syscall.SockFilter, error) {
+	block := []instruction{
+		loadAbs(offsetNr),
+		jumpOrFail(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr),
+	}
+	for _, arg := range args {
+		condition, err := compileArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, condition...)
+	}
+	block = append(block, ret(actionValue))
+
+	// 跳转到规则末尾, 即下一条规则的第一条指令
+	filters := make([]syscall.SockFilter, len(block))
+	for i, inst := range block {
+		offset := len(block) - i - 1
+		if offset > 255 {
+			return nil, fmt.Errorf("too many argument conditions")
+		}
+		if inst.jtFail {
+			inst.Jt = uint8(offset)
+		}
+		if inst.jfFail {
+			inst.Jf = uint8(offset)
+		}
+		filters[i] = inst.SockFilter
+	}
+
+	return filters, nil
+}
+
+// 编译64位参数的比较条件, 分别比较高32位和低32位
+func compileArg(arg *Arg) ([]instruction, error) {
+	if arg.Index >= maxSyscallArgs {
+		return nil, fmt.Errorf("invalid argument index %d", arg.Index)
+	}
+	lowOffset, highOffset := uint32(offsetArgs+8*arg.Index), uint32(offsetArgs+8*arg.Index+4)
+	if isBigEndian() {
+		lowOffset, highOffset = highOffset, lowOffset
+	}
+	high, low := uint32(arg.Value>>32), uint32(arg.Value)
+
+	const (
+		jeq = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jgt = syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K
+		jge = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+		and = syscall.BPF_ALU | syscall.BPF_AND | syscall.BPF_K
+	)
+	switch arg.Op {
+	case OpEqualTo:
+		return []instruction{
+			loadAbs(highOffset), jumpOrFail(jeq, high),
+			loadAbs(lowOffset), jumpOrFail(jeq, low),
+		}, nil
+	case OpNotEqual:
+		// 高32位不相等时跳过低32位的比较
+		return []instruction{
+			loadAbs(highOffset), jump(jeq, high, 0, 2),
+			loadAbs(lowOffset), failIf(jeq, low),
+		}, nil
+	case OpMaskedEqual:
+		valueHigh, valueLow := uint32(arg.ValueTwo>>32), uint32(arg.ValueTwo)
+		return []instruction{
+			loadAbs(highOffset), stmt(and, high), jumpOrFail(jeq, valueHigh),
+			loadAbs(lowOffset), stmt(and, low), jumpOrFail(jeq, valueLow),
+		}, nil
+	case OpGreaterThan, OpGreaterEqual:
+		lowCode := uint16(jgt)
+		if arg.Op == OpGreaterEqual {
+			lowCode = jge
+		}
+		// 高32位大于时条件成立, 相等时再比较低32位
+		return []instruction{
+			loadAbs(highOffset), jump(jgt, high, 3, 0), jumpOrFail(jeq, high),
+			loadAbs(lowOffset), jumpOrFail(lowCode, low),
+		}, nil
+	case OpLessThan, OpLessEqual:
+		lowCode := uint16(jge)
+		if arg.Op == OpLessEqual {
+			lowCode = jgt
+		}
+		// 高32位小于时条件成立, 相等时再比较低32位
+		return []instruction{
+			loadAbs(highOffset), failIf(jgt, high), jump(jeq, high, 0, 2),
+			loadAbs(lowOffset), failIf(lowCode, low),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", arg.Op)
+	}
+}
+
+// 将配置中的action转换为seccomp返回值, errno未指定时使用EPERM
+func actionRet(action Action, errnoRet, defaultErrnoRet *uint) (uint32, error) {
+	errno := uint32(syscall.EPERM)
+	if errnoRet != nil {
+		errno = uint32(*errnoRet)
+	} else if defaultErrnoRet != nil {
+		errno = uint32(*defaultErrnoRet)
+	}
+
+	switch action {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | (errno & 0xffff), nil
+	case ActTrace:
+		return retTrace | (errno & 0xffff), nil
+	case ActAllow:
+		return retAllow, nil
+	case ActLog:
+		return retLog, nil
+	default:
+		return 0, fmt.Errorf("unsupported seccomp action %q", action)
+	}
+}
+
+// 判断规则在当前架构和容器capability下是否生效
+func isRuleEnabled(rule *Syscall, caps []string) bool {
+	if len(rule.Includes.Arches) > 0 && !containsString(rule.Includes.Arches, runtime.GOARCH) {
+		return false
+	}
+	if containsString(rule.Excludes.Arches, runtime.GOARCH) {
+		return false
+	}
+	for _, capability := range rule.Includes.Caps {
+		if !containsString(caps, capability) {
+			return false
+		}
+	}
+	for _, capability := range rule.Excludes.Caps {
+		if containsString(caps, capability) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
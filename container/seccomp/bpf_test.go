@@ -0,0 +1,249 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+// 构造 struct seccomp_data, 字段按本机字节序排列
+func newSeccompData(arch, nr uint32, args ...uint64) []byte {
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if isBigEndian() {
+		byteOrder = binary.BigEndian
+	}
+
+	data := make([]byte, offsetArgs+8*maxSyscallArgs)
+	byteOrder.PutUint32(data[offsetNr:], nr)
+	byteOrder.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		byteOrder.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+
+	return data
+}
+
+// 按内核的语义执行编译生成的bpf程序, 返回seccomp返回值
+func runFilter(t *testing.T, program []syscall.SockFilter, data []byte) uint32 {
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if isBigEndian() {
+		byteOrder = binary.BigEndian
+	}
+
+	var acc uint32
+	for pc := 0; pc < len(program); pc++ {
+		inst := program[pc]
+		switch inst.Code {
+		case syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS:
+			if int(inst.K)+4 > len(data) {
+				t.Fatalf("pc %d loads out of range offset %d", pc, inst.K)
+			}
+			acc = byteOrder.Uint32(data[inst.K:])
+		case syscall.BPF_ALU | syscall.BPF_AND | syscall.BPF_K:
+			acc &= inst.K
+		case syscall.BPF_JMP | syscall.BPF_JA:
+			pc += int(inst.K)
+		case syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K,
+			syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K,
+			syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K:
+			var matched bool
+			switch inst.Code & 0xf0 {
+			case syscall.BPF_JEQ:
+				matched = acc == inst.K
+			case syscall.BPF_JGT:
+				matched = acc > inst.K
+			case syscall.BPF_JGE:
+				matched = acc >= inst.K
+			}
+			if matched {
+				pc += int(inst.Jt)
+			} else {
+				pc += int(inst.Jf)
+			}
+		case syscall.BPF_RET | syscall.BPF_K:
+			return inst.K
+		default:
+			t.Fatalf("pc %d has unsupported instruction %#x", pc, inst.Code)
+		}
+	}
+	t.Fatalf("program ends without return")
+
+	return 0
+}
+
+func TestCompileArg(t *testing.T) {
+	if nativeArch == 0 {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+
+	const value = 0x100000005
+	tests := []struct {
+		name  string
+		arg   Arg
+		input uint64
+		match bool
+	}{
+		{"eq equal", Arg{Value: value, Op: OpEqualTo}, value, true},
+		{"eq low differs", Arg{Value: value, Op: OpEqualTo}, 0x100000006, false},
+		{"eq high differs", Arg{Value: value, Op: OpEqualTo}, 0x5, false},
+		{"ne equal", Arg{Value: value, Op: OpNotEqual}, value, false},
+		{"ne low differs", Arg{Value: value, Op: OpNotEqual}, 0x100000006, true},
+		{"ne high differs", Arg{Value: value, Op: OpNotEqual}, 0x200000005, true},
+		{"gt equal", Arg{Value: value, Op: OpGreaterThan}, value, false},
+		{"gt low greater", Arg{Value: value, Op: OpGreaterThan}, 0x100000006, true},
+		{"gt high greater", Arg{Value: value, Op: OpGreaterThan}, 0x200000000, true},
+		{"gt high less", Arg{Value: value, Op: OpGreaterThan}, 0xffffffff, false},
+		{"gt low less", Arg{Value: value, Op: OpGreaterThan}, 0x100000004, false},
+		{"ge equal", Arg{Value: value, Op: OpGreaterEqual}, value, true},
+		{"ge low less", Arg{Value: value, Op: OpGreaterEqual}, 0x100000004, false},
+		{"ge high greater", Arg{Value: value, Op: OpGreaterEqual}, 0x200000000, true},
+		{"lt equal", Arg{Value: value, Op: OpLessThan}, value, false},
+		{"lt low less", Arg{Value: value, Op: OpLessThan}, 0x100000004, true},
+		{"lt high less", Arg{Value: value, Op: OpLessThan}, 0xffffffff, true},
+		{"lt high greater", Arg{Value: value, Op: OpLessThan}, 0x200000000, false},
+		{"lt low greater", Arg{Value: value, Op: OpLessThan}, 0x100000006, false},
+		{"le equal", Arg{Value: value, Op: OpLessEqual}, value, true},
+		{"le low greater", Arg{Value: value, Op: OpLessEqual}, 0x100000006, false},
+		{"le high less", Arg{Value: value, Op: OpLessEqual}, 0x5, true},
+		{"masked eq match", Arg{Value: 0x1000000f0, ValueTwo: 0x100000010, Op: OpMaskedEqual}, 0x100000013, true},
+		{"masked eq ignores unmasked bits", Arg{Value: 0x1000000f0, ValueTwo: 0x100000010, Op: OpMaskedEqual}, 0xff0000001f, true},
+		{"masked eq low differs", Arg{Value: 0x1000000f0, ValueTwo: 0x100000010, Op: OpMaskedEqual}, 0x100000020, false},
+		{"masked eq high differs", Arg{Value: 0x1000000f0, ValueTwo: 0x100000010, Op: OpMaskedEqual}, 0x10, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arg := test.arg
+			arg.Index = 1
+			profile := &Profile{
+				DefaultAction: ActAllow,
+				Syscalls:      []*Syscall{{Names: []string{"getpid"}, Action: ActErrno, Args: []*Arg{&arg}}},
+			}
+			program, err := compile(profile, nil)
+			if err != nil {
+				t.Fatalf("compile error, %v", err)
+			}
+
+			want := uint32(retAllow)
+			if test.match {
+				want = retErrno | uint32(syscall.EPERM)
+			}
+			got := runFilter(t, program, newSeccompData(nativeArch, syscallNumbers["getpid"], 0, test.input))
+			if got != want {
+				t.Errorf("input %#x: got %#x, want %#x", test.input, got, want)
+			}
+		})
+	}
+}
+
+func TestCompileRule(t *testing.T) {
+	if nativeArch == 0 {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+
+	eperm, enosys := uint(syscall.EPERM), uint(syscall.ENOSYS)
+	profile := &Profile{
+		DefaultAction:   ActErrno,
+		DefaultErrnoRet: &eperm,
+		Syscalls: []*Syscall{
+			{
+				// 所有参数条件都满足时规则才生效
+				Names:  []string{"getpid"},
+				Action: ActAllow,
+				Args: []*Arg{
+					{Index: 0, Value: 1, Op: OpEqualTo},
+					{Index: 2, Value: 10, Op: OpGreaterThan},
+				},
+			},
+			{Names: []string{"getpid"}, Action: ActErrno, ErrnoRet: &enosys},
+			{Name: "gettid", Names: []string{"getppid"}, Action: ActAllow},
+		},
+	}
+	program, err := compile(profile, nil)
+	if err != nil {
+		t.Fatalf("compile error, %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		syscall string
+		args    []uint64
+		want    uint32
+	}{
+		{"all args match", "getpid", []uint64{1, 0, 11}, retAllow},
+		{"first arg differs", "getpid", []uint64{2, 0, 11}, retErrno | uint32(syscall.ENOSYS)},
+		{"second arg differs", "getpid", []uint64{1, 0, 10}, retErrno | uint32(syscall.ENOSYS)},
+		{"name field", "gettid", nil, retAllow},
+		{"names field", "getppid", nil, retAllow},
+		{"default action", "getuid", nil, retErrno | uint32(syscall.EPERM)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := runFilter(t, program, newSeccompData(nativeArch, syscallNumbers[test.syscall], test.args...))
+			if got != test.want {
+				t.Errorf("got %#x, want %#x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDefaultProfile(t *testing.T) {
+	if nativeArch == 0 {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+
+	program, err := compile(DefaultProfile(), []string{"CAP_CHOWN", "CAP_KILL", "CAP_SETUID"})
+	if err != nil {
+		t.Fatalf("compile error, %v", err)
+	}
+	eperm := retErrno | uint32(syscall.EPERM)
+
+	tests := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		args []uint64
+		want uint32
+	}{
+		{"allowed syscall", nativeArch, syscallNumbers["getpid"], nil, retAllow},
+		{"syscall not in allowlist", nativeArch, syscallNumbers["mount"], nil, eperm},
+		{"unknown syscall", nativeArch, 0xfff, nil, eperm},
+		{"personality default domain", nativeArch, syscallNumbers["personality"], []uint64{0}, retAllow},
+		{"personality addr no randomize", nativeArch, syscallNumbers["personality"], []uint64{0x0040000}, eperm},
+		{"clone thread", nativeArch, syscallNumbers["clone"], []uint64{syscall.CLONE_VM | syscall.CLONE_THREAD}, retAllow},
+		{"clone new user namespace", nativeArch, syscallNumbers["clone"], []uint64{syscall.CLONE_NEWUSER}, eperm},
+		{"socket inet", nativeArch, syscallNumbers["socket"], []uint64{syscall.AF_INET}, retAllow},
+		{"socket vsock", nativeArch, syscallNumbers["socket"], []uint64{afVsock}, eperm},
+		{"unknown arch", 0x1234, syscallNumbers["getpid"], nil, retKillProcess},
+	}
+	if x32SyscallBit != 0 {
+		tests = append(tests, struct {
+			name string
+			arch uint32
+			nr   uint32
+			args []uint64
+			want uint32
+		}{"x32 syscall", nativeArch, x32SyscallBit | syscallNumbers["getpid"], nil, eperm})
+	}
+	if compatArch != 0 {
+		tests = append(tests, []struct {
+			name string
+			arch uint32
+			nr   uint32
+			args []uint64
+			want uint32
+		}{
+			{"compat allowed syscall", compatArch, compatSyscallNumbers["getpid"], nil, retAllow},
+			{"compat syscall not in allowlist", compatArch, compatSyscallNumbers["mount"], nil, eperm},
+		}...)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := runFilter(t, program, newSeccompData(test.arch, test.nr, test.args...))
+			if got != test.want {
+				t.Errorf("got %#x, want %#x", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package seccomp
+
+// Profile seccomp配置, 与docker的seccomp profile格式兼容
+type Profile struct {
+	DefaultAction   Action     `json:"defaultAction"`
+	DefaultErrnoRet *uint      `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string   `json:"architectures,omitempty"`
+	ArchMap         []*ArchMap `json:"archMap,omitempty"`
+	Syscalls        []*Syscall `json:"syscalls"`
+}
+
+// ArchMap 本机架构及可以在本机上执行的子架构, 只有本机架构对应的子架构生效
+type ArchMap struct {
+	Arch      string   `json:"architecture"`
+	SubArches []string `json:"subArchitectures"`
+}
+
+// Syscall 一组系统调用的过滤规则, 所有参数条件都满足时执行Action
+type Syscall struct {
+	Name     string   `json:"name,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args,omitempty"`
+	Comment  string   `json:"comment,omitempty"`
+	Includes Filter   `json:"includes,omitempty"`
+	Excludes Filter   `json:"excludes,omitempty"`
+}
+
+// Filter 规则生效条件, Includes需要容器拥有全部caps, Excludes在容器拥有任一caps时跳过规则
+type Filter struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+// Arg 系统调用参数条件, MASKED_EQ时Value为掩码, ValueTwo为比较值
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo"`
+	Op       Operator `json:"op"`
+}
+
+// Action 规则匹配时的动作
+type Action string
+
+// Operator 参数比较方式
+type Operator string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+	ActLog         Action = "SCMP_ACT_LOG"
+
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ"
+
+	// 系统调用架构
+	ArchX86_64  = "SCMP_ARCH_X86_64"
+	ArchX86     = "SCMP_ARCH_X86"
+	ArchX32     = "SCMP_ARCH_X32"
+	ArchAarch64 = "SCMP_ARCH_AARCH64"
+	ArchArm     = "SCMP_ARCH_ARM"
+
+	// --security-opt 中的seccomp配置
+	SecurityOptPrefix = "seccomp="
+	Unconfined        = "unconfined"
+
+	// 容器信息目录下保存的seccomp配置, 供exec进程使用
+	ProfileFileName = "seccomp.json"
+)
+
+const (
+	// 内核seccomp返回值, 见 linux/seccomp.h
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+
+	seccompModeFilter = 2
+
+	// struct seccomp_data 中的字段偏移
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+
+	// 单个bpf程序的最大指令数
+	bpfMaxInstructions = 4096
+
+	// 系统调用最多6个参数
+	maxSyscallArgs = 6
+)
@@ -0,0 +1,110 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ParseSecurityOpt 解析 --security-opt 参数中的seccomp配置
+// 未指定时使用默认配置, seccomp=unconfined 时返回nil, 否则按docker格式读取指定的json文件
+func ParseSecurityOpt(securityOpts []string) (*Profile, error) {
+	profile := DefaultProfile()
+	for _, opt := range securityOpts {
+		if !strings.HasPrefix(opt, SecurityOptPrefix) {
+			return nil, fmt.Errorf("unsupported security option %q", opt)
+		}
+
+		value := strings.TrimPrefix(opt, SecurityOptPrefix)
+		if value == Unconfined {
+			profile = nil
+			continue
+		}
+		loaded, err := LoadProfile(value)
+		if err != nil {
+			return nil, err
+		}
+		profile = loaded
+	}
+
+	return profile, nil
+}
+
+// IsUnconfined 判断 --security-opt 参数是否关闭了seccomp, 与ParseSecurityOpt一致, 以最后一个配置为准
+func IsUnconfined(securityOpts []string) bool {
+	unconfined := false
+	for _, opt := range securityOpts {
+		unconfined = opt == SecurityOptPrefix+Unconfined
+	}
+
+	return unconfined
+}
+
+// LoadProfile 读取json格式的seccomp配置, 并检查配置能否编译
+func LoadProfile(profilePath string) (*Profile, error) {
+	content, err := ioutil.ReadFile(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("seccomp profile read error, %v", err)
+	}
+
+	profile := &Profile{}
+	if err = json.Unmarshal(content, profile); err != nil {
+		return nil, fmt.Errorf("seccomp profile %s unmarshal error, %v", profilePath, err)
+	}
+	if _, err = compile(profile, nil); err != nil {
+		return nil, fmt.Errorf("seccomp profile %s invalid, %v", profilePath, err)
+	}
+
+	return profile, nil
+}
+
+// SaveProfile 将seccomp配置保存为json文件
+func SaveProfile(profilePath string, profile *Profile) error {
+	content, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("seccomp profile marshal error, %v", err)
+	}
+	if err = ioutil.WriteFile(profilePath, content, 0644); err != nil {
+		return fmt.Errorf("seccomp profile write error, %v", err)
+	}
+
+	return nil
+}
+
+// InitSeccomp 为当前线程安装seccomp过滤器, caps为用户进程保留的capability
+// 过滤器是线程属性, 调用后当前goroutine锁定在该线程上, 用户进程需由该线程exec或fork
+func InitSeccomp(profile *Profile, caps []string) error {
+	if profile == nil {
+		return nil
+	}
+	if nativeArch == 0 {
+		return fmt.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+
+	filters, err := compile(profile, caps)
+	if err != nil {
+		return err
+	}
+	program := syscall.SockFprog{
+		Len:    uint16(len(filters)),
+		Filter: &filters[0],
+	}
+
+	runtime.LockOSThread()
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return fmt.Errorf("seccomp filter install error, %v", errno)
+	}
+
+	return nil
+}
+
+// 判断当前架构的字节序
+func isBigEndian() bool {
+	var value uint16 = 1
+	return *(*byte)(unsafe.Pointer(&value)) == 0
+}
@@ -0,0 +1,18 @@
+//go:build !amd64 && !arm64
+// +build !amd64,!arm64
+
+package seccomp
+
+// 未支持的架构, 所有系统调用都不在过滤规则中, 只保留默认动作
+const (
+	nativeArch     = 0
+	x32SyscallBit  = 0
+	compatArch     = 0
+	nativeArchName = ""
+	compatArchName = ""
+)
+
+var (
+	syscallNumbers       = map[string]uint32{}
+	compatSyscallNumbers = map[string]uint32{}
+)
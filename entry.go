@@ -22,10 +22,27 @@ func main() {
 		cmd.LoadCommand,
 		cmd.ListCommand,
 		cmd.LogCommand,
+		cmd.InspectCommand,
 		cmd.ExecCommand,
 		cmd.StopCommand,
 		cmd.RmCommand,
 		cmd.NetworkCmd,
+		cmd.ImagesCommand,
+		cmd.RmiCommand,
+		cmd.ImageCommand,
+		cmd.TagCommand,
+		cmd.PullCommand,
+		cmd.PushCommand,
+		cmd.CommitCommand,
+		cmd.BuildCommand,
+	}
+
+	// 执行命令前检查数据目录和运行时目录, 容器init进程使用父进程已检查的目录
+	app.Before = func(ctx *cli.Context) error {
+		if ctx.Args().First() == cmd.InitCmd.Name {
+			return nil
+		}
+		return config.CheckRootDirs()
 	}
 
 	if err := app.Run(os.Args); err != nil {
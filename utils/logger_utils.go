@@ -30,5 +30,5 @@ func (util *loggerUtil) Fatalf(format string, args ...interface{}) {
 
 // Errorf print format error message
 func (util *loggerUtil) Errorf(format string, args ...interface{}) {
-	log.Errorf(format, args)
+	log.Errorf(format, args...)
 }